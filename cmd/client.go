@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hsn723/container-tag-exists/pkg"
+	"github.com/cybozu-go/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	config     = &pkg.Config{}
+	tokenCache = pkg.NewTokenCache()
+	// rateLimiter is shared by all clients so that limits hold across images.
+	rateLimiter = pkg.NewRateLimiter()
+	pullSecret  *pkg.PullSecret
+	// dialOverrides is set if --resolve or --connect-to were given.
+	dialOverrides *pkg.DialOverrides
+	// har records HTTP exchanges if --har was given.
+	har *pkg.HAR
+	// timeoutChanged is true if --timeout was given, overriding the
+	// configuration file.
+	timeoutChanged bool
+
+	// httpClients holds the HTTP client of each registry, so that
+	// connections are reused across clients for the same registry.
+	httpClients   = map[string]*http.Client{}
+	httpClientsMu sync.Mutex
+
+	// legacyWarned holds the registries for which ignored legacy credential
+	// variables were already reported.
+	legacyWarned sync.Map
+)
+
+func loadConfig(cmd *cobra.Command, _ []string) error {
+	timeoutChanged = cmd.Flags().Changed("timeout")
+	path := configPath
+	optional := path == ""
+	if optional {
+		p, err := pkg.DefaultConfigPath()
+		if err != nil {
+			return err
+		}
+		path = p
+	}
+	c, err := pkg.LoadConfig(path, optional)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration %s: %w", path, err)
+	}
+	config = c
+	if err := setupTracing(cmd.Context()); err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	if debug {
+		log.DefaultLogger().SetThreshold(log.LvDebug)
+	}
+	if harPath != "" {
+		har = pkg.NewHAR("container-tag-exists", version)
+	}
+	if len(resolve) > 0 || len(connectTo) > 0 {
+		o, err := pkg.ParseDialOverrides(resolve, connectTo)
+		if err != nil {
+			return err
+		}
+		dialOverrides = o
+	}
+	if secretPath != "" {
+		s, err := pkg.LoadPullSecret(secretPath)
+		if err != nil {
+			return err
+		}
+		pullSecret = s
+	}
+	if !cacheFile {
+		return nil
+	}
+	cachePath, err := pkg.DefaultTokenCachePath()
+	if err != nil {
+		return err
+	}
+	tc, err := pkg.NewFileTokenCache(cachePath)
+	if err != nil {
+		return err
+	}
+	tokenCache = tc
+	return nil
+}
+
+func mirrorsFor(registryURL string) ([]string, error) {
+	var res []string
+	for _, m := range mirrors {
+		registry, mirror, ok := strings.Cut(m, "=")
+		if !ok || registry == "" || mirror == "" {
+			return nil, fmt.Errorf("malformed mirror %q, expected REGISTRY=MIRROR", m)
+		}
+		if registry == registryURL {
+			res = append(res, mirror)
+		}
+	}
+	return res, nil
+}
+
+func logEndpoint(registryClient *pkg.RegistryClient, endpoint string) {
+	if len(registryClient.Mirrors) == 0 {
+		return
+	}
+	_ = log.Info("registry answered", map[string]interface{}{
+		"image":    fmt.Sprintf("%s/%s", registryClient.RegistryURL, registryClient.ImagePath),
+		"endpoint": endpoint,
+	})
+}
+
+// warnLegacyEnvs warns once per registry about credential variables set only
+// under the legacy registry name, which are ignored.
+func warnLegacyEnvs(registryClient *pkg.RegistryClient) {
+	envs := registryClient.IgnoredLegacyEnvs()
+	if len(envs) == 0 {
+		return
+	}
+	if _, warned := legacyWarned.LoadOrStore(registryClient.RegistryURL, true); warned {
+		return
+	}
+	for _, env := range envs {
+		_ = log.Warn("ignoring credentials under the legacy registry name", map[string]interface{}{
+			"registry": registryClient.RegistryURL,
+			"variable": env.Name,
+			"rename":   env.Current,
+		})
+	}
+}
+
+// logPullLimit logs the pull limit reported by the registry, if any.
+func logPullLimit(limit *pkg.PullLimit) {
+	if limit == nil {
+		return
+	}
+	_ = log.Debug("pull limit", map[string]interface{}{
+		"limit":     limit.Limit,
+		"remaining": limit.Remaining,
+		"window":    limit.Window().String(),
+		"source":    limit.Source,
+	})
+}
+
+func newHTTPClient(rc pkg.RegistryConfig) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		// Skipping verification is opt-in, per registry.
+		InsecureSkipVerify: rc.Insecure, //nolint:gosec
+	}
+	if rc.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		ca, err := os.ReadFile(rc.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", rc.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	proxyURL := rc.Proxy
+	if proxy != "" {
+		proxyURL = proxy
+	}
+	proxyFunc, err := pkg.ProxyFunc(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	clientTimeout := timeout
+	if !timeoutChanged && rc.Timeout != 0 {
+		clientTimeout = rc.Timeout
+	}
+	transport := &http.Transport{
+		Proxy:               proxyFunc,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:     tlsConfig,
+	}
+	if dialOverrides != nil {
+		transport.DialContext = dialOverrides.DialContext(&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		})
+	}
+	var roundTripper http.RoundTripper = transport
+	if debug || har != nil {
+		tracing := &pkg.TracingTransport{Base: transport, HAR: har}
+		if debug {
+			tracing.Log = log.Debug
+		}
+		roundTripper = tracing
+	}
+	return &http.Client{
+		Timeout:   clientTimeout,
+		Transport: roundTripper,
+	}, nil
+}
+
+// httpClientFor returns the HTTP client for the registry, creating it on
+// first use.
+func httpClientFor(registryURL string, rc pkg.RegistryConfig) (*http.Client, error) {
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+	if c, ok := httpClients[registryURL]; ok {
+		return c, nil
+	}
+	c, err := newHTTPClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	httpClients[registryURL] = c
+	return c, nil
+}
+
+func newRegistryClient(image string) (*pkg.RegistryClient, error) {
+	registryURL, err := pkg.ExtractRegistryURL(image)
+	if err != nil {
+		return nil, err
+	}
+	imagePath, err := pkg.ExtractImagePath(image)
+	if err != nil {
+		return nil, err
+	}
+	return newRegistryClientForPath(registryURL, imagePath)
+}
+
+// newRegistryClientForPath is like newRegistryClient, for a repository given
+// apart from the registry. The repository may be empty.
+func newRegistryClientForPath(registryURL, imagePath string) (*pkg.RegistryClient, error) {
+	registryName := pkg.NormalizeRegistryName(registryURL)
+	rc := config.ForRegistry(registryURL)
+	if rc.Credentials.Env != "" {
+		registryName = rc.Credentials.Env
+	}
+	registryMirrors, err := mirrorsFor(registryURL)
+	if err != nil {
+		return nil, err
+	}
+	if registryMirrors == nil {
+		registryMirrors = rc.Mirrors
+	}
+	httpClient, err := httpClientFor(registryURL, rc)
+	if err != nil {
+		return nil, err
+	}
+	registryClient := &pkg.RegistryClient{
+		RegistryName:          registryName,
+		RegistryURL:           registryURL,
+		ImagePath:             imagePath,
+		HttpClient:            httpClient,
+		Platforms:             rc.Platforms,
+		Mirrors:               registryMirrors,
+		PlainHTTP:             rc.PlainHTTP,
+		TokenEndpoint:         rc.TokenEndpoint,
+		Retry:                 rc.Retry,
+		TokenCache:            tokenCache,
+		RateLimiter:           rateLimiter,
+		RateLimit:             rc.RateLimit,
+		PullSecret:            pullSecret,
+		RepositoryCredentials: rc.Credentials.Repositories,
+		TracerProvider:        clientTracerProvider(),
+		MirrorClient:          mirrorClient(imagePath),
+	}
+	warnLegacyEnvs(registryClient)
+	return registryClient, nil
+}
+
+// mirrorClient returns a function building the client for a mirror from the
+// mirror's own settings in the configuration file.
+func mirrorClient(imagePath string) func(string) (*pkg.RegistryClient, error) {
+	return func(mirror string) (*pkg.RegistryClient, error) {
+		host := strings.TrimPrefix(strings.TrimPrefix(mirror, "http://"), "https://")
+		return newRegistryClientForPath(host, imagePath)
+	}
+}
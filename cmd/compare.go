@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/Hsn723/container-tag-exists/pkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	compareCmd = &cobra.Command{
+		Use:   "compare SRC DST",
+		Short: "compare two image references",
+		Long:  "compare two image references, in the format IMAGE:TAG or IMAGE@DIGEST, and report whether they point to identical content",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runCompare,
+		// Drift is reported as an error, which should not print usage.
+		SilenceUsage: true,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+}
+
+func resolveDigests(ref string) (pkg.ImageDigests, error) {
+	image, reference, err := pkg.SplitReference(ref)
+	if err != nil {
+		return pkg.ImageDigests{}, err
+	}
+	registryClient, err := newRegistryClient(image)
+	if err != nil {
+		return pkg.ImageDigests{}, err
+	}
+	digests, err := registryClient.GetDigests(reference)
+	if err != nil {
+		return pkg.ImageDigests{}, err
+	}
+	logEndpoint(registryClient, digests.Endpoint)
+	logPullLimit(digests.PullLimit)
+	return digests, nil
+}
+
+func runCompare(cmd *cobra.Command, args []string) error {
+	src, err := resolveDigests(args[0])
+	if err != nil {
+		return err
+	}
+	dst, err := resolveDigests(args[1])
+	if err != nil {
+		return err
+	}
+	comparison := pkg.CompareImages(src, dst)
+	if comparison.Identical {
+		fmt.Printf("identical %s\n", src.Digest)
+		return nil
+	}
+	fmt.Printf("digests differ: %s != %s\n", src.Digest, dst.Digest)
+	for _, d := range comparison.Diverged {
+		fmt.Printf("%s: %s != %s\n", d.Platform, digestOrMissing(d.SourceDigest), digestOrMissing(d.DestinationDigest))
+	}
+	return fmt.Errorf("%s and %s differ: %w", args[0], args[1], errDrift)
+}
+
+func digestOrMissing(digest string) string {
+	if digest == "" {
+		return "missing"
+	}
+	return digest
+}
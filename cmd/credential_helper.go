@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Hsn723/container-tag-exists/pkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	credentialHelperCmd = &cobra.Command{
+		Use:   "credential-helper",
+		Short: "act as a docker credential helper",
+		Long:  "implement the docker credential helper protocol with the credentials container-tag-exists finds for registries, so that docker and other tools can use them. Also enabled when invoked as docker-credential-*.",
+	}
+
+	credentialHelperGetCmd = &cobra.Command{
+		Use:   "get",
+		Short: "print credentials for the server URL read from standard input",
+		Args:  cobra.NoArgs,
+		RunE:  runCredentialHelperGet,
+		// Failures are reported on standard output as per the protocol.
+		SilenceUsage: true,
+	}
+
+	credentialHelperStoreCmd = &cobra.Command{
+		Use:          "store",
+		Short:        "not supported, credentials are read from the environment",
+		Args:         cobra.NoArgs,
+		RunE:         runCredentialHelperReadOnly,
+		SilenceUsage: true,
+	}
+
+	credentialHelperEraseCmd = &cobra.Command{
+		Use:          "erase",
+		Short:        "not supported, credentials are read from the environment",
+		Args:         cobra.NoArgs,
+		RunE:         runCredentialHelperReadOnly,
+		SilenceUsage: true,
+	}
+)
+
+const (
+	credentialHelperPrefix = "docker-credential-"
+	// credentialsNotFoundMessage is the message docker expects from helpers
+	// that have no credentials for a server.
+	credentialsNotFoundMessage = "credentials not found in native keychain"
+)
+
+// helperCredentials is the output of the get action of the docker credential
+// helper protocol.
+type helperCredentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+func init() {
+	credentialHelperCmd.AddCommand(credentialHelperGetCmd, credentialHelperStoreCmd, credentialHelperEraseCmd)
+	rootCmd.AddCommand(credentialHelperCmd)
+}
+
+// credentialHelperArgs returns the arguments to run the credential helper
+// with if the program was invoked as docker-credential-*, or nil otherwise.
+func credentialHelperArgs() []string {
+	if !strings.HasPrefix(filepath.Base(os.Args[0]), credentialHelperPrefix) {
+		return nil
+	}
+	return append([]string{credentialHelperCmd.Name()}, os.Args[1:]...)
+}
+
+func runCredentialHelperGet(cmd *cobra.Command, _ []string) error {
+	in, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return err
+	}
+	serverURL := strings.TrimSpace(string(in))
+	if serverURL == "" {
+		return errors.New("no server URL given on standard input")
+	}
+	registryClient, err := newRegistryClientForPath(pkg.RegistryURLFromServerURL(serverURL), "")
+	if err != nil {
+		return err
+	}
+	user, secret, err := registryClient.HelperCredentials()
+	if errors.Is(err, pkg.ErrCredentialsNotFound) {
+		fmt.Fprintln(cmd.OutOrStdout(), credentialsNotFoundMessage)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(cmd.OutOrStdout()).Encode(helperCredentials{
+		ServerURL: serverURL,
+		Username:  user,
+		Secret:    secret,
+	})
+}
+
+func runCredentialHelperReadOnly(cmd *cobra.Command, _ []string) error {
+	return fmt.Errorf("%s is not supported, credentials are read from the environment", cmd.Name())
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Hsn723/container-tag-exists/pkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	doctorCmd = &cobra.Command{
+		Use:   "doctor IMAGE [TAG]",
+		Short: "explain credential resolution and access failures",
+		Long:  "list the credential sources consulted for an image in order and whether they are set, without printing secrets, request the manifest of a tag, latest by default, anonymously, with an anonymous token and with credentials, and suggest how to fix failures",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE:  runDoctor,
+	}
+
+	doctorOutput string
+)
+
+const defaultDoctorTag = "latest"
+
+func init() {
+	doctorCmd.Flags().StringVarP(&doctorOutput, "output", "o", "table", "output format, one of table or json")
+	rootCmd.AddCommand(doctorCmd)
+}
+
+func foundOrMissing(found bool) string {
+	if found {
+		return "found"
+	}
+	return "missing"
+}
+
+func attemptResult(a pkg.AuthAttempt) string {
+	switch {
+	case a.Error != "":
+		return "failed"
+	case a.OK:
+		return "granted"
+	}
+	return "denied"
+}
+
+func writeClaims(w *tabwriter.Writer, c *pkg.TokenClaims) {
+	if c.Issuer != "" {
+		fmt.Fprintf(w, "  issuer\t%s\n", c.Issuer)
+	}
+	if c.Subject != "" {
+		fmt.Fprintf(w, "  subject\t%s\n", c.Subject)
+	}
+	if len(c.Audience) > 0 {
+		fmt.Fprintf(w, "  audience\t%s\n", strings.Join(c.Audience, ", "))
+	}
+	if c.IssuedAt != nil {
+		fmt.Fprintf(w, "  issued at\t%s\n", c.IssuedAt.Format(time.RFC3339))
+	}
+	if c.Expiry != nil {
+		fmt.Fprintf(w, "  expires at\t%s\n", c.Expiry.Format(time.RFC3339))
+	}
+	for _, scope := range c.Access {
+		fmt.Fprintf(w, "  access\t%s\n", scope)
+	}
+}
+
+func writeDoctorTable(d pkg.Diagnosis) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "image\t%s/%s:%s\n", d.Registry, d.Repository, d.Tag)
+	fmt.Fprintf(w, "registry name\t%s\n", d.RegistryName)
+	if d.NormalizedName != d.RegistryName {
+		fmt.Fprintf(w, "normalized name\t%s\n", d.NormalizedName)
+	}
+	if d.CredentialName != "" {
+		fmt.Fprintf(w, "repository credential name\t%s\n", d.CredentialName)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "SOURCE\tKIND\tSTATUS\tDETAIL")
+	for _, s := range d.Sources {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Name, s.Kind, foundOrMissing(s.Found), s.Detail)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "ATTEMPT\tRESULT\tSTATUS\tDETAIL")
+	for _, a := range d.Attempts {
+		status := ""
+		if a.Status != 0 {
+			status = fmt.Sprint(a.Status)
+		}
+		detail := a.Error
+		if detail == "" && a.Scheme != "" {
+			detail = fmt.Sprintf("%s token", a.Scheme)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", a.Method, attemptResult(a), status, detail)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, a := range d.Attempts {
+		if a.Claims == nil {
+			continue
+		}
+		fmt.Printf("\n%s token claims:\n", a.Method)
+		w = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		writeClaims(w, a.Claims)
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(d.Suggestions) > 0 {
+		fmt.Println("\nsuggestions:")
+		for _, s := range d.Suggestions {
+			fmt.Printf("  - %s\n", s)
+		}
+	}
+	return nil
+}
+
+func writeDoctorJSON(d pkg.Diagnosis) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	var write func(pkg.Diagnosis) error
+	switch doctorOutput {
+	case "table":
+		write = writeDoctorTable
+	case "json":
+		write = writeDoctorJSON
+	default:
+		return fmt.Errorf("unknown output format %q", doctorOutput)
+	}
+	registryClient, err := newRegistryClient(args[0])
+	if err != nil {
+		return err
+	}
+	tag := defaultDoctorTag
+	if len(args) > 1 {
+		tag = args[1]
+	}
+	return write(registryClient.Diagnose(tag))
+}
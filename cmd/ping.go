@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Hsn723/container-tag-exists/pkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pingCmd = &cobra.Command{
+		Use:   "ping REGISTRY[/REPOSITORY]",
+		Short: "check registry reachability and capabilities",
+		Long:  "call the API version check endpoint of a registry, report the TLS connection, API version and authentication challenge, and probe optional features. HEAD requests, tag list pagination and the referrers API are probed on the repository, if given.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runPing,
+		// An unreachable registry is reported as an error, which should not
+		// print usage.
+		SilenceUsage: true,
+	}
+
+	pingOutput string
+)
+
+func init() {
+	pingCmd.Flags().StringVarP(&pingOutput, "output", "o", "table", "output format, one of table or json")
+	rootCmd.AddCommand(pingCmd)
+}
+
+func writePingTable(res pkg.PingResult) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "registry\t%s\n", res.Registry)
+	fmt.Fprintf(w, "endpoint\t%s\n", res.Endpoint)
+	if !res.Reachable {
+		fmt.Fprintf(w, "reachable\tno: %s\n", res.Error)
+		return w.Flush()
+	}
+	fmt.Fprintf(w, "reachable\tyes, status %d\n", res.Status)
+	if res.APIVersion != "" {
+		fmt.Fprintf(w, "api version\t%s\n", res.APIVersion)
+	}
+	if res.TLS != nil {
+		tlsInfo := []string{res.TLS.Version, res.TLS.CipherSuite}
+		if res.TLS.ALPN != "" {
+			tlsInfo = append(tlsInfo, res.TLS.ALPN)
+		}
+		fmt.Fprintf(w, "tls\t%s\n", strings.Join(tlsInfo, ", "))
+		for _, cert := range res.TLS.Certificates {
+			fmt.Fprintf(w, "certificate\t%s, issued by %s, expires %s\n", cert.Subject, cert.Issuer, cert.NotAfter.Format("2006-01-02"))
+		}
+	}
+	if c := res.Challenge; c != nil {
+		auth := []string{c.Scheme}
+		if c.Realm != "" {
+			auth = append(auth, fmt.Sprintf("realm=%s", c.Realm))
+		}
+		if c.Service != "" {
+			auth = append(auth, fmt.Sprintf("service=%s", c.Service))
+		}
+		fmt.Fprintf(w, "auth\t%s\n", strings.Join(auth, " "))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FEATURE\tSTATUS\tDETAIL")
+	for _, f := range res.Features {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", f.Feature, f.Status, f.Detail)
+	}
+	return w.Flush()
+}
+
+func writePingJSON(res pkg.PingResult) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
+
+func runPing(cmd *cobra.Command, args []string) error {
+	var write func(pkg.PingResult) error
+	switch pingOutput {
+	case "table":
+		write = writePingTable
+	case "json":
+		write = writePingJSON
+	default:
+		return fmt.Errorf("unknown output format %q", pingOutput)
+	}
+	var registryClient *pkg.RegistryClient
+	var err error
+	if strings.Contains(args[0], "/") {
+		registryClient, err = newRegistryClient(args[0])
+	} else {
+		registryClient, err = newRegistryClientForPath(args[0], "")
+	}
+	if err != nil {
+		return err
+	}
+	res := registryClient.Ping()
+	if err := write(res); err != nil {
+		return err
+	}
+	if !res.Reachable {
+		return fmt.Errorf("%s is unreachable", res.Registry)
+	}
+	return nil
+}
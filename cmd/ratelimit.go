@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Hsn723/container-tag-exists/pkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rateLimitCmd = &cobra.Command{
+		Use:   "ratelimit",
+		Short: "show the Docker Hub pull limit",
+		Long:  "show the Docker Hub pull limit applying to the current credentials, or to anonymous pulls if there are none, without consuming a pull",
+		Args:  cobra.NoArgs,
+		RunE:  runRateLimit,
+	}
+
+	rateLimitOutput string
+)
+
+const pullLimitImage = "docker.io/ratelimitpreview/test"
+
+func init() {
+	rateLimitCmd.Flags().StringVarP(&rateLimitOutput, "output", "o", "table", "output format, one of table or json")
+	rootCmd.AddCommand(rateLimitCmd)
+}
+
+func writeRateLimitTable(limit *pkg.PullLimit) error {
+	if limit == nil {
+		fmt.Println("no pull limit reported")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "LIMIT\tREMAINING\tWINDOW\tSOURCE\tAUTHENTICATED")
+	fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%t\n", limit.Limit, limit.Remaining, limit.Window(), limit.Source, limit.Authenticated)
+	return w.Flush()
+}
+
+func writeRateLimitJSON(limit *pkg.PullLimit) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(limit)
+}
+
+func runRateLimit(cmd *cobra.Command, _ []string) error {
+	var write func(*pkg.PullLimit) error
+	switch rateLimitOutput {
+	case "table":
+		write = writeRateLimitTable
+	case "json":
+		write = writeRateLimitJSON
+	default:
+		return fmt.Errorf("unknown output format %q", rateLimitOutput)
+	}
+	registryClient, err := newRegistryClient(pullLimitImage)
+	if err != nil {
+		return err
+	}
+	limit, err := registryClient.GetPullLimit()
+	if err != nil {
+		return err
+	}
+	return write(limit)
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	registryNameCmd = &cobra.Command{
+		Use:   "registry-name IMAGE",
+		Short: "show environment variables consulted for credentials",
+		Long:  "show the environment variables consulted for credentials for an image, in the order they are consulted",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runRegistryName,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(registryNameCmd)
+}
+
+func runRegistryName(cmd *cobra.Command, args []string) error {
+	registryClient, err := newRegistryClient(args[0])
+	if err != nil {
+		return err
+	}
+	for _, name := range registryClient.CredentialEnvNames() {
+		fmt.Println(name)
+	}
+	return nil
+}
@@ -1,11 +1,12 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"net/http"
+	"os"
 	"time"
 
-	"github.com/Hsn723/container-tag-exists/pkg"
 	"github.com/cybozu-go/log"
 	"github.com/spf13/cobra"
 )
@@ -17,9 +18,32 @@ var (
 		Long:  "check for the existence of a container tag against repositories using the Registry API v2",
 		Args:  cobra.ExactArgs(2),
 		RunE:  runRoot,
+
+		PersistentPreRunE: loadConfig,
 	}
 
-	platforms []string
+	platforms  []string
+	mirrors    []string
+	configPath string
+	timeout    time.Duration
+	cacheFile  bool
+	secretPath string
+	proxy      string
+	resolve    []string
+	connectTo  []string
+	debug      bool
+	harPath    string
+
+	// errDrift is returned when compared images or repositories are not in sync.
+	errDrift = errors.New("drift detected")
+)
+
+const (
+	// exitDrift is the exit status used when drift is detected, to tell it
+	// apart from errors.
+	exitDrift = 2
+
+	defaultTimeout = 10 * time.Second
 )
 
 func init() {
@@ -27,35 +51,33 @@ func init() {
 	_ = rootCmd.LocalFlags().MarkHidden("loglevel")
 	_ = rootCmd.LocalFlags().MarkHidden("logformat")
 	rootCmd.Flags().StringSliceVarP(&platforms, "platform", "p", nil, "specify platforms in the format os/arch to look for in container images. Default behavior is to look for any platform.")
+	rootCmd.PersistentFlags().StringArrayVar(&mirrors, "mirror", nil, "specify a mirror to try before the registry in the format REGISTRY=MIRROR. Can be repeated, mirrors are tried in order.")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "path to the configuration file. Default is $XDG_CONFIG_HOME/container-tag-exists/config.yaml if it exists.")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", defaultTimeout, "timeout for each request to the registry.")
+	rootCmd.PersistentFlags().BoolVar(&cacheFile, "token-cache", false, "persist bearer tokens under $XDG_CACHE_HOME/container-tag-exists to reuse them across invocations.")
+	rootCmd.PersistentFlags().StringVar(&proxy, "proxy", "", "URL of the HTTP, HTTPS or SOCKS5 proxy to use for all registries, or \"direct\" to bypass proxies. Default is to use HTTPS_PROXY, HTTP_PROXY and NO_PROXY.")
+	rootCmd.PersistentFlags().StringArrayVar(&resolve, "resolve", nil, "connect to ADDR instead of the resolved address of HOST:PORT in the format HOST:PORT:ADDR[,ADDR]..., keeping the Host header and TLS server name. Can be repeated.")
+	rootCmd.PersistentFlags().StringArrayVar(&connectTo, "connect-to", nil, "connect to HOST2:PORT2 instead of HOST1:PORT1 in the format HOST1:PORT1:HOST2:PORT2, keeping the Host header and TLS server name. Empty fields match any host or port, or are left unchanged. Can be repeated.")
+	rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "v", false, "log each HTTP request and response, with secrets redacted.")
+	rootCmd.PersistentFlags().StringVar(&harPath, "har", "", "write HTTP requests and responses, with secrets redacted, to the given file in the HAR format.")
+	rootCmd.PersistentFlags().StringVar(&secretPath, "pull-secret", "", "path to a Kubernetes Secret of type kubernetes.io/dockerconfigjson, in YAML or JSON, to read registry credentials from.")
 }
 
 func runRoot(cmd *cobra.Command, args []string) error {
-	registryURL, err := pkg.ExtractRegistryURL(args[0])
-	if err != nil {
-		return err
-	}
-	registryName := pkg.NormalizeRegistryName(registryURL)
-	imagePath, err := pkg.ExtractImagePath(args[0])
+	registryClient, err := newRegistryClient(args[0])
 	if err != nil {
 		return err
 	}
-	registryClient := &pkg.RegistryClient{
-		RegistryName: registryName,
-		RegistryURL:  registryURL,
-		ImagePath:    imagePath,
-		HttpClient: &http.Client{
-			Timeout: 10 * time.Second,
-			Transport: &http.Transport{
-				TLSHandshakeTimeout: 10 * time.Second,
-			},
-		},
-		Platforms: platforms,
+	if cmd.Flags().Changed("platform") {
+		registryClient.Platforms = platforms
 	}
-	hasTag, err := registryClient.IsTagExist(args[1])
+	res, err := registryClient.CheckTagContext(cmd.Context(), args[1])
 	if err != nil {
 		return err
 	}
-	if hasTag {
+	logEndpoint(registryClient, res.Endpoint)
+	logPullLimit(res.PullLimit)
+	if res.Found {
 		fmt.Println("found")
 	}
 	return nil
@@ -63,7 +85,29 @@ func runRoot(cmd *cobra.Command, args []string) error {
 
 // Execute runs the root command.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	if args := credentialHelperArgs(); args != nil {
+		rootCmd.SetArgs(args)
+	}
+	err := rootCmd.Execute()
+	if tracingErr := shutdownTracing(context.Background()); tracingErr != nil {
+		_ = log.Warn("failed to export spans", map[string]interface{}{
+			log.FnError: tracingErr.Error(),
+		})
+	}
+	// The archive is most useful when the command failed.
+	if har != nil {
+		if harErr := har.WriteFile(harPath); harErr != nil {
+			_ = log.Error("failed to write HAR file", map[string]interface{}{
+				"path":      harPath,
+				log.FnError: harErr.Error(),
+			})
+		}
+	}
+	if err != nil {
+		if errors.Is(err, errDrift) {
+			_ = log.Error(err.Error(), nil)
+			os.Exit(exitDrift)
+		}
 		log.ErrorExit(err)
 	}
 }
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Hsn723/container-tag-exists/pkg"
+	"github.com/cybozu-go/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveCmd = &cobra.Command{
+		Use:          "serve",
+		Short:        "answer tag lookups over HTTP",
+		Long:         "serve tag lookups as JSON over HTTP at /v1/exists, for one reference with GET or for many with POST, reusing tokens and connections across requests and caching results, with /healthz and /readyz for health checks. On SIGINT or SIGTERM, report not ready and finish in-flight requests before exiting.",
+		Args:         cobra.NoArgs,
+		RunE:         runServe,
+		SilenceUsage: true,
+	}
+
+	serveListen          string
+	serveCacheTTL        time.Duration
+	serveNegativeTTL     time.Duration
+	serveShutdownTimeout time.Duration
+)
+
+const (
+	defaultServeListen          = ":8080"
+	defaultServeCacheTTL        = 5 * time.Minute
+	defaultServeNegativeTTL     = 30 * time.Second
+	defaultServeShutdownTimeout = 30 * time.Second
+)
+
+func init() {
+	serveCmd.Flags().StringVar(&serveListen, "listen", defaultServeListen, "address to listen on.")
+	serveCmd.Flags().DurationVar(&serveCacheTTL, "cache-ttl", defaultServeCacheTTL, "how long to cache tags that exist. 0 disables caching.")
+	serveCmd.Flags().DurationVar(&serveNegativeTTL, "negative-cache-ttl", defaultServeNegativeTTL, "how long to cache tags that do not exist. 0 disables caching.")
+	serveCmd.Flags().DurationVar(&serveShutdownTimeout, "shutdown-timeout", defaultServeShutdownTimeout, "how long to wait for in-flight requests when shutting down.")
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServe(cmd *cobra.Command, _ []string) error {
+	ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	s := pkg.NewServer(newRegistryClient, serveCacheTTL, serveNegativeTTL)
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			// Lookups carry the command context for tracing, but are not
+			// cancelled on shutdown so that they can finish.
+			return context.WithoutCancel(ctx)
+		},
+	}
+	ln, err := net.Listen("tcp", serveListen)
+	if err != nil {
+		return err
+	}
+	_ = log.Info("serving", map[string]interface{}{
+		"address": ln.Addr().String(),
+	})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+	s.SetReady(true)
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	s.SetReady(false)
+	_ = log.Info("shutting down", nil)
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), serveShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
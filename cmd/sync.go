@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Hsn723/container-tag-exists/pkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncCheckCmd = &cobra.Command{
+		Use:   "sync-check SRC DST...",
+		Short: "check whether repositories are in sync",
+		Long:  "list tags in a source repository and one or more destination repositories, and report tags that are missing, mismatched or extra on the destinations",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  runSyncCheck,
+		// Drift is reported as an error, which should not print usage.
+		SilenceUsage: true,
+	}
+
+	syncOutput string
+)
+
+func init() {
+	syncCheckCmd.Flags().StringVarP(&syncOutput, "output", "o", "table", "output format, one of table or json")
+	rootCmd.AddCommand(syncCheckCmd)
+}
+
+func writeSyncTable(reports []pkg.SyncReport) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "DESTINATION\tTAG\tSTATUS\tSOURCE DIGEST\tDESTINATION DIGEST")
+	for _, report := range reports {
+		for _, tag := range report.Missing {
+			fmt.Fprintf(w, "%s\t%s\tmissing\t\t\n", report.Destination, tag)
+		}
+		for _, m := range report.Mismatched {
+			fmt.Fprintf(w, "%s\t%s\tmismatched\t%s\t%s\n", report.Destination, m.Tag, m.SourceDigest, m.DestinationDigest)
+		}
+		for _, tag := range report.Extra {
+			fmt.Fprintf(w, "%s\t%s\textra\t\t\n", report.Destination, tag)
+		}
+	}
+	return w.Flush()
+}
+
+func writeSyncJSON(reports []pkg.SyncReport) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
+
+func runSyncCheck(cmd *cobra.Command, args []string) error {
+	var write func([]pkg.SyncReport) error
+	switch syncOutput {
+	case "table":
+		write = writeSyncTable
+	case "json":
+		write = writeSyncJSON
+	default:
+		return fmt.Errorf("unknown output format %q", syncOutput)
+	}
+	src, err := newRegistryClient(args[0])
+	if err != nil {
+		return err
+	}
+	dsts := make([]pkg.RegistryClient, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		dst, err := newRegistryClient(arg)
+		if err != nil {
+			return err
+		}
+		dsts = append(dsts, *dst)
+	}
+	reports, err := pkg.CheckSync(*src, dsts)
+	if err != nil {
+		return err
+	}
+	if err := write(reports); err != nil {
+		return err
+	}
+	for _, report := range reports {
+		if report.HasDrift() {
+			return errDrift
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerProvider exports spans over OTLP if an endpoint is configured in the
+// environment, and is nil otherwise.
+var tracerProvider *sdktrace.TracerProvider
+
+// otlpEnabled returns true if an OTLP endpoint for traces is configured.
+func otlpEnabled() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// setupTracing creates the tracer provider exporting spans over OTLP/HTTP,
+// configured by the standard OTEL_* environment variables.
+func setupTracing(ctx context.Context) error {
+	if !otlpEnabled() {
+		return nil
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			attribute.String("service.name", "container-tag-exists"),
+			attribute.String("service.version", version),
+		),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return err
+	}
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	return nil
+}
+
+// clientTracerProvider returns the tracer provider given to registry
+// clients, nil if tracing is disabled.
+func clientTracerProvider() trace.TracerProvider {
+	if tracerProvider == nil {
+		return nil
+	}
+	return tracerProvider
+}
+
+// shutdownTracing flushes pending spans.
+func shutdownTracing(ctx context.Context) error {
+	if tracerProvider == nil {
+		return nil
+	}
+	return tracerProvider.Shutdown(ctx)
+}
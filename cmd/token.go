@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	tokenCmd = &cobra.Command{
+		Use:   "token IMAGE",
+		Short: "print a pull-scoped bearer token",
+		Long:  "print a bearer token granting pull access to the repository of an image, obtained with the credentials for its registry, or an anonymous token if there are none",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runToken,
+	}
+
+	tokenHeader bool
+)
+
+func init() {
+	tokenCmd.Flags().BoolVar(&tokenHeader, "header", false, "print an Authorization header, for instance for curl -H, which also works for registries using basic authentication.")
+	rootCmd.AddCommand(tokenCmd)
+}
+
+func runToken(cmd *cobra.Command, args []string) error {
+	registryClient, err := newRegistryClient(args[0])
+	if err != nil {
+		return err
+	}
+	auth, err := registryClient.PullAuthorization()
+	if err != nil {
+		return err
+	}
+	if tokenHeader {
+		fmt.Printf("Authorization: %s\n", auth)
+		return nil
+	}
+	if auth.Scheme != "Bearer" {
+		return fmt.Errorf("%s uses %s authentication rather than bearer tokens, use --header", registryClient.RegistryURL, auth.Scheme)
+	}
+	fmt.Println(auth.Token)
+	return nil
+}
@@ -0,0 +1,118 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var (
+	acrExchangeAPI = "%s/oauth2/exchange"
+	aadTokenAPI    = "%s/%s/oauth2/v2.0/token"
+)
+
+const (
+	aadAuthorityHost = "https://login.microsoftonline.com"
+	aadScope         = "https://management.azure.com/.default"
+)
+
+// acrProvider obtains credentials for Azure Container Registry by exchanging
+// an Azure AD access token for an ACR refresh token.
+type acrProvider struct{}
+
+func (acrProvider) match(registryURL string) bool {
+	for _, suffix := range []string{".azurecr.io", ".azurecr.cn", ".azurecr.us"} {
+		if strings.HasSuffix(registryURL, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (acrProvider) envNames() []string {
+	return []string{"AZURE_TENANT_ID", "AZURE_CLIENT_ID", "AZURE_CLIENT_SECRET"}
+}
+
+func (p acrProvider) credentials(r RegistryClient) (Credentials, error) {
+	aadToken, err := p.aadToken(r)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("could not get an Azure AD access token for %s: %w", r.RegistryURL, err)
+	}
+	refreshToken, err := p.exchange(r, aadToken)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return Credentials{RefreshToken: refreshToken}, nil
+}
+
+// aadToken returns the Azure AD access token in ${REGISTRY_NAME}_AAD_TOKEN,
+// or requests one with the client credentials in AZURE_TENANT_ID,
+// AZURE_CLIENT_ID and AZURE_CLIENT_SECRET. The authority can be overridden
+// with AZURE_AUTHORITY_HOST. ErrCredentialsNotFound is returned if none of
+// these are set.
+func (acrProvider) aadToken(r RegistryClient) (string, error) {
+	if token := r.getenv("AAD_TOKEN"); token != "" {
+		return token, nil
+	}
+	tenant := os.Getenv("AZURE_TENANT_ID")
+	clientID := os.Getenv("AZURE_CLIENT_ID")
+	clientSecret := os.Getenv("AZURE_CLIENT_SECRET")
+	if tenant == "" && clientID == "" && clientSecret == "" {
+		return "", fmt.Errorf("%w: neither %s_AAD_TOKEN nor AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET are set", ErrCredentialsNotFound, r.RegistryName)
+	}
+	if tenant == "" || clientID == "" || clientSecret == "" {
+		return "", fmt.Errorf("AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET must all be set")
+	}
+	authority := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authority == "" {
+		authority = aadAuthorityHost
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"scope":         {aadScope},
+	}
+	headers := map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded",
+	}
+	endpoint := fmt.Sprintf(aadTokenAPI, strings.TrimSuffix(authority, "/"), tenant)
+	status, _, res, err := r.retrieveWithBody(http.MethodPost, endpoint, headers, []byte(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	return parseAccessToken(status, res)
+}
+
+// exchange swaps an Azure AD access token for an ACR refresh token.
+func (acrProvider) exchange(r RegistryClient, aadToken string) (string, error) {
+	form := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {r.RegistryURL},
+		"access_token": {aadToken},
+	}
+	if tenant := os.Getenv("AZURE_TENANT_ID"); tenant != "" {
+		form.Set("tenant", tenant)
+	}
+	headers := map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded",
+	}
+	status, _, res, err := r.retrieveWithBody(http.MethodPost, fmt.Sprintf(acrExchangeAPI, r.baseURL()), headers, []byte(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("unexpected response from ACR token exchange: %d", status)
+	}
+	var token tokenResponse
+	if err := json.Unmarshal(res, &token); err != nil {
+		return "", err
+	}
+	if token.RefreshToken == "" {
+		return "", fmt.Errorf("empty refresh token in ACR token exchange")
+	}
+	return token.RefreshToken, nil
+}
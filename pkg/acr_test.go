@@ -0,0 +1,127 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACRProviderMatch(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title    string
+		registry string
+		expect   bool
+	}{
+		{
+			title:    "ACR",
+			registry: "hoge.azurecr.io",
+			expect:   true,
+		},
+		{
+			title:    "ACRChina",
+			registry: "hoge.azurecr.cn",
+			expect:   true,
+		},
+		{
+			title:    "ACRGovernment",
+			registry: "hoge.azurecr.us",
+			expect:   true,
+		},
+		{
+			title:    "Lookalike",
+			registry: "azurecr.io.example.com",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, c.expect, acrProvider{}.match(c.registry))
+		})
+	}
+}
+
+func TestACRProviderCredentials(t *testing.T) {
+	cases := []struct {
+		title        string
+		aadToken     string
+		clientSecret string
+		exchange     string
+		expect       Credentials
+		isErr        bool
+	}{
+		{
+			title:    "AADToken",
+			aadToken: "aad-hoge",
+			exchange: `{"refresh_token":"acr-hoge"}`,
+			expect:   Credentials{RefreshToken: "acr-hoge"},
+		},
+		{
+			title:        "ClientCredentials",
+			clientSecret: "secret",
+			exchange:     `{"refresh_token":"acr-hoge"}`,
+			expect:       Credentials{RefreshToken: "acr-hoge"},
+		},
+		{
+			title:        "WrongClientSecret",
+			clientSecret: "wrong",
+			exchange:     `{"refresh_token":"acr-hoge"}`,
+			isErr:        true,
+		},
+		{
+			title:    "EmptyRefreshToken",
+			aadToken: "aad-hoge",
+			exchange: `{}`,
+			isErr:    true,
+		},
+		{
+			title: "NoCredentials",
+			isErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			t.Helper()
+			mux := http.NewServeMux()
+			mux.HandleFunc("/hoge-tenant/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Fatal(err)
+				}
+				if r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("client_id") != "hoge-client" || r.PostForm.Get("client_secret") != "secret" || r.PostForm.Get("scope") != aadScope {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				_, _ = w.Write([]byte(`{"access_token":"aad-hoge","expires_in":3599,"token_type":"Bearer"}`))
+			})
+			mux.HandleFunc("/oauth2/exchange", func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Fatal(err)
+				}
+				if r.PostForm.Get("grant_type") != "access_token" || r.PostForm.Get("access_token") != "aad-hoge" || r.PostForm.Get("service") != r.Host {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				_, _ = w.Write([]byte(c.exchange))
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+			t.Setenv("HOGE_AZURECR_IO_AAD_TOKEN", c.aadToken)
+			t.Setenv("AZURE_TENANT_ID", "hoge-tenant")
+			t.Setenv("AZURE_CLIENT_ID", "hoge-client")
+			t.Setenv("AZURE_CLIENT_SECRET", c.clientSecret)
+			t.Setenv("AZURE_AUTHORITY_HOST", server.URL+"/")
+			client := RegistryClient{
+				RegistryName: "HOGE_AZURECR_IO",
+				RegistryURL:  server.Listener.Addr().String(),
+				HttpClient:   http.DefaultClient,
+				PlainHTTP:    true,
+			}
+			actual, err := acrProvider{}.credentials(client)
+			assertExpectedErr(t, err, c.isErr)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package pkg
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	quayAuthAPI = "%s/v2/auth?service=%s&scope=%s"
+	authAPI     = "%s/token?scope=%s"
+
+	adaptersMu sync.RWMutex
+	// adapters lists the adapters in the order they are tried, registered
+	// ones first.
+	adapters = []RegistryAdapter{
+		dockerHubAdapter{},
+		quayAdapter{},
+		providerAdapter{provider: ecrProvider{}},
+		providerAdapter{provider: gcrProvider{}},
+		providerAdapter{provider: acrProvider{}},
+	}
+)
+
+// Credentials holds credentials obtained by an adapter: a bearer token, a
+// refresh token for the OAuth2 flow, or a basic auth token, the base64
+// encoded form of user:pass, tried in this order.
+type Credentials struct {
+	Token        string
+	RefreshToken string
+	AuthToken    string
+}
+
+// RegistryAdapter describes how to talk to registries that depart from the
+// Registry API and token authentication specifications, or that need
+// credentials from elsewhere than the environment. Implementations can embed
+// DefaultAdapter and override only what differs.
+type RegistryAdapter interface {
+	// Match returns true if the adapter handles the registry, given as the
+	// host, and optionally port, used in image names.
+	Match(registryURL string) bool
+	// APIRoot returns the host serving the Registry API of the registry,
+	// optionally followed by a path prefix under which /v2/ is served.
+	APIRoot(registryURL string) string
+	// Scope returns the token scope granting pull access to the repository.
+	Scope(repository string) string
+	// TokenURL returns the URL bearer tokens are requested from with basic
+	// authentication, given the base URL of the Registry API, or "" to use
+	// the realm of the registry's authentication challenge.
+	TokenURL(baseURL, registryURL, scope string) string
+	// Credentials returns credentials for the registry, used when none are
+	// found in the environment. Empty credentials mean there are none.
+	Credentials(r RegistryClient) (Credentials, error)
+}
+
+// DefaultAdapter implements the behavior described by the Registry API and
+// token authentication specifications.
+type DefaultAdapter struct{}
+
+// Match matches any registry.
+func (DefaultAdapter) Match(string) bool {
+	return true
+}
+
+// APIRoot returns the registry itself.
+func (DefaultAdapter) APIRoot(registryURL string) string {
+	return registryURL
+}
+
+// Scope returns the repository scope with the pull action.
+func (DefaultAdapter) Scope(repository string) string {
+	return fmt.Sprintf("repository:%s:pull", repository)
+}
+
+// TokenURL returns "", so that tokens are requested from the realm of the
+// registry's authentication challenge.
+func (DefaultAdapter) TokenURL(string, string, string) string {
+	return ""
+}
+
+// Credentials returns no credentials.
+func (DefaultAdapter) Credentials(RegistryClient) (Credentials, error) {
+	return Credentials{}, nil
+}
+
+// RegisterAdapter registers an adapter, tried before built-in adapters and
+// adapters registered earlier.
+func RegisterAdapter(a RegistryAdapter) {
+	adaptersMu.Lock()
+	defer adaptersMu.Unlock()
+	adapters = append([]RegistryAdapter{a}, adapters...)
+}
+
+// AdapterFor returns the first adapter matching the registry, or
+// DefaultAdapter if there is none.
+func AdapterFor(registryURL string) RegistryAdapter {
+	adaptersMu.RLock()
+	defer adaptersMu.RUnlock()
+	for _, a := range adapters {
+		if a.Match(registryURL) {
+			return a
+		}
+	}
+	return DefaultAdapter{}
+}
+
+func (r RegistryClient) adapter() RegistryAdapter {
+	return AdapterFor(r.RegistryURL)
+}
+
+// dockerHubAdapter serves Docker Hub images, named after docker.io, from
+// registry-1.docker.io.
+type dockerHubAdapter struct {
+	DefaultAdapter
+}
+
+func (dockerHubAdapter) Match(registryURL string) bool {
+	return registryURL == "docker.io" || registryURL == "index.docker.io"
+}
+
+func (dockerHubAdapter) APIRoot(string) string {
+	return "registry-1.docker.io"
+}
+
+// quayAdapter requests tokens from the /v2/auth endpoint of quay.io.
+type quayAdapter struct {
+	DefaultAdapter
+}
+
+func (quayAdapter) Match(registryURL string) bool {
+	return registryURL == "quay.io"
+}
+
+func (quayAdapter) TokenURL(baseURL, registryURL, scope string) string {
+	return fmt.Sprintf(quayAuthAPI, baseURL, registryURL, scope)
+}
+
+// providerAdapter obtains credentials from a cloud provider.
+type providerAdapter struct {
+	DefaultAdapter
+	provider credentialProvider
+}
+
+func (a providerAdapter) Match(registryURL string) bool {
+	return a.provider.match(registryURL)
+}
+
+func (a providerAdapter) Credentials(r RegistryClient) (Credentials, error) {
+	return a.provider.credentials(r)
+}
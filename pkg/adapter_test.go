@@ -0,0 +1,105 @@
+package pkg
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdapterFor(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title    string
+		registry string
+		expect   RegistryAdapter
+	}{
+		{
+			title:    "DockerHub",
+			registry: "docker.io",
+			expect:   dockerHubAdapter{},
+		},
+		{
+			title:    "Quay",
+			registry: "quay.io",
+			expect:   quayAdapter{},
+		},
+		{
+			title:    "ECR",
+			registry: "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com",
+			expect:   providerAdapter{provider: ecrProvider{}},
+		},
+		{
+			title:    "Default",
+			registry: "ghcr.io",
+			expect:   DefaultAdapter{},
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, c.expect, AdapterFor(c.registry))
+		})
+	}
+}
+
+func TestBuiltinAdapters(t *testing.T) {
+	t.Parallel()
+	docker := RegistryClient{RegistryURL: "docker.io", ImagePath: "library/alpine"}
+	assert.Equal(t, "https://registry-1.docker.io", docker.baseURL())
+	quay := RegistryClient{RegistryURL: "quay.io", ImagePath: "hsn723/hoge"}
+	assert.Equal(t, "https://quay.io/v2/auth?service=quay.io&scope=repository:hsn723/hoge:pull", quay.adapter().TokenURL(quay.baseURL(), quay.RegistryURL, quay.scope()))
+	ghcr := RegistryClient{RegistryURL: "ghcr.io", ImagePath: "hsn723/hoge"}
+	assert.Empty(t, ghcr.adapter().TokenURL(ghcr.baseURL(), ghcr.RegistryURL, ghcr.scope()))
+}
+
+// customAdapter serves a registry from another host and supplies its
+// credentials, as a library user would.
+type customAdapter struct {
+	DefaultAdapter
+	host string
+	auth string
+}
+
+func (customAdapter) Match(registryURL string) bool {
+	return registryURL == "custom.example"
+}
+
+func (a customAdapter) APIRoot(string) string {
+	return a.host
+}
+
+func (a customAdapter) Credentials(RegistryClient) (Credentials, error) {
+	return Credentials{AuthToken: a.auth}, nil
+}
+
+func TestRegisterAdapter(t *testing.T) {
+	registry := mockRegistry{
+		t:      t,
+		scope:  "repository:hsn723/hoge:pull",
+		basic:  "aG9nZTpoaWdl",
+		bearer: "aG9nZWJlYXJlcg==",
+		tags:   []string{"1.0.0"},
+	}
+	registry.init()
+	adaptersMu.Lock()
+	saved := adapters
+	adaptersMu.Unlock()
+	t.Cleanup(func() {
+		adaptersMu.Lock()
+		adapters = saved
+		adaptersMu.Unlock()
+	})
+	RegisterAdapter(customAdapter{host: registry.server.Listener.Addr().String(), auth: "aG9nZTpoaWdl"})
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	client := RegistryClient{
+		RegistryName: "CUSTOM_EXAMPLE",
+		RegistryURL:  "custom.example",
+		ImagePath:    "hsn723/hoge",
+		HttpClient:   http.DefaultClient,
+	}
+	actual, err := client.IsTagExist("1.0.0")
+	assert.NoError(t, err)
+	assert.True(t, actual)
+}
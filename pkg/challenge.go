@@ -0,0 +1,169 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+var (
+	pingAPI = "%s/v2/"
+)
+
+const (
+	// anonymousIdentity is the token cache identity of anonymous tokens.
+	anonymousIdentity = "anonymous"
+)
+
+// Challenge is an authentication challenge sent by a registry in the
+// WWW-Authenticate header.
+type Challenge struct {
+	Scheme  string `json:"scheme"`
+	Realm   string `json:"realm,omitempty"`
+	Service string `json:"service,omitempty"`
+	Scope   string `json:"scope,omitempty"`
+}
+
+// challengeCache holds the authentication challenge of a registry, so that
+// it is requested at most once per lookup rather than by every step of the
+// authentication flow.
+type challengeCache struct {
+	once      sync.Once
+	challenge Challenge
+	err       error
+}
+
+// withChallengeCache returns a copy of the client requesting the
+// authentication challenge of the registry at most once, shared with the
+// client it is called on if that already caches it.
+func (r RegistryClient) withChallengeCache() RegistryClient {
+	if r.challenge == nil {
+		r.challenge = &challengeCache{}
+	}
+	return r
+}
+
+// parseChallenge parses the first challenge of a WWW-Authenticate header.
+func parseChallenge(header string) (Challenge, error) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	if scheme == "" {
+		return Challenge{}, fmt.Errorf("empty WWW-Authenticate header")
+	}
+	c := Challenge{Scheme: strings.ToLower(scheme)}
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, ", "), "=")
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				return Challenge{}, fmt.Errorf("unterminated quoted value in WWW-Authenticate header %q", header)
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "realm":
+			c.Realm = value
+		case "service":
+			c.Service = value
+		case "scope":
+			c.Scope = value
+		}
+	}
+	return c, nil
+}
+
+// ping calls the API version check endpoint of the registry.
+func (r RegistryClient) ping() (int, http.Header, error) {
+	status, header, _, err := r.retrieveWithHeader(http.MethodGet, fmt.Sprintf(pingAPI, r.baseURL()), nil)
+	return status, header, err
+}
+
+// getChallenge returns the authentication challenge of the registry, from
+// the cache if the client has one.
+func (r RegistryClient) getChallenge() (Challenge, error) {
+	if r.challenge == nil {
+		return r.fetchChallenge()
+	}
+	r.challenge.once.Do(func() {
+		r.challenge.challenge, r.challenge.err = r.fetchChallenge()
+	})
+	return r.challenge.challenge, r.challenge.err
+}
+
+// fetchChallenge requests the authentication challenge of the registry.
+func (r RegistryClient) fetchChallenge() (Challenge, error) {
+	status, header, err := r.ping()
+	if err != nil {
+		return Challenge{}, err
+	}
+	if status != http.StatusUnauthorized {
+		return Challenge{}, fmt.Errorf("registry did not send an authentication challenge: %d", status)
+	}
+	return parseChallenge(header.Get("WWW-Authenticate"))
+}
+
+// usesBasicAuth returns true if the registry expects basic authentication
+// on API requests rather than bearer tokens.
+func (r RegistryClient) usesBasicAuth() bool {
+	c, err := r.getChallenge()
+	return err == nil && c.Scheme == "basic"
+}
+
+func (r RegistryClient) scope() string {
+	return r.adapter().Scope(r.ImagePath)
+}
+
+// tokenURL builds the token request URL from the challenge realm.
+func (r RegistryClient) tokenURL(c Challenge) (string, error) {
+	u, err := url.Parse(c.Realm)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	if c.Service != "" {
+		q.Set("service", c.Service)
+	}
+	q.Set("scope", r.scope())
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// getAnonymousToken requests a bearer token without credentials, as required
+// by registries that reject unauthenticated requests even for public images.
+func (r RegistryClient) getAnonymousToken() (string, error) {
+	if cached := r.cachedToken(anonymousIdentity); cached != "" {
+		return cached, nil
+	}
+	c, err := r.getChallenge()
+	if err != nil {
+		return "", err
+	}
+	if c.Scheme != "bearer" || c.Realm == "" {
+		return "", fmt.Errorf("unsupported authentication scheme %q", c.Scheme)
+	}
+	endpoint, err := r.tokenURL(c)
+	if err != nil {
+		return "", err
+	}
+	status, res, err := r.retrieve(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("unexpected response code %d", status)
+	}
+	var token tokenResponse
+	if err := json.Unmarshal(res, &token); err != nil {
+		return "", err
+	}
+	if token.bearer() == "" {
+		return "", fmt.Errorf("empty anonymous token")
+	}
+	r.cacheToken(anonymousIdentity, token)
+	return token.bearer(), nil
+}
@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChallenge(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title  string
+		header string
+		expect Challenge
+		isErr  bool
+	}{
+		{
+			title:  "DockerHub",
+			header: `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`,
+			expect: Challenge{Scheme: "bearer", Realm: "https://auth.docker.io/token", Service: "registry.docker.io"},
+		},
+		{
+			title:  "ScopeWithComma",
+			header: `Bearer realm="https://ghcr.io/token",service="ghcr.io",scope="repository:hsn723/hoge:pull,push"`,
+			expect: Challenge{Scheme: "bearer", Realm: "https://ghcr.io/token", Service: "ghcr.io", Scope: "repository:hsn723/hoge:pull,push"},
+		},
+		{
+			title:  "Basic",
+			header: `Basic realm="https://123456789012.dkr.ecr.us-east-1.amazonaws.com/"`,
+			expect: Challenge{Scheme: "basic", Realm: "https://123456789012.dkr.ecr.us-east-1.amazonaws.com/"},
+		},
+		{
+			title:  "Unquoted",
+			header: `Bearer realm=https://registry.dev/token, service=registry.dev`,
+			expect: Challenge{Scheme: "bearer", Realm: "https://registry.dev/token", Service: "registry.dev"},
+		},
+		{
+			title:  "Empty",
+			header: "",
+			isErr:  true,
+		},
+		{
+			title:  "Unterminated",
+			header: `Bearer realm="https://registry.dev/token`,
+			isErr:  true,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			actual, err := parseChallenge(c.header)
+			assertExpectedErr(t, err, c.isErr)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// ciCredentials describes the registry credentials a CI platform injects into
+// its jobs. Bitbucket Pipelines has no built-in container registry and is
+// therefore not listed.
+type ciCredentials struct {
+	// match returns true if the platform injects credentials for the registry.
+	match func(r RegistryClient) bool
+	// user lists the environment variables holding the username, in order.
+	user []string
+	// defaultUser is used when none of the user variables are set.
+	defaultUser string
+	// password lists the environment variables holding the password or
+	// token, in order.
+	password []string
+	// bearer indicates that the base64 encoded password is accepted as a
+	// bearer token as is.
+	bearer bool
+}
+
+var (
+	ciPlatforms = []ciCredentials{
+		// GitHub Actions. ghcr.io accepts GITHUB_TOKEN or a PAT as a bearer
+		// token. The registry is matched by host, whatever its credential
+		// name, so that the token is never sent to other hosts.
+		{
+			match: func(r RegistryClient) bool {
+				return r.RegistryURL == "ghcr.io"
+			},
+			password: []string{"GITHUB_TOKEN"},
+			bearer:   true,
+		},
+		// GitLab CI.
+		{
+			match:       matchEnvRegistry("GITLAB_CI", "CI_REGISTRY"),
+			user:        []string{"CI_REGISTRY_USER"},
+			defaultUser: "gitlab-ci-token",
+			password:    []string{"CI_REGISTRY_PASSWORD", "CI_JOB_TOKEN"},
+		},
+		// Gitea Actions, which serves the registry on the instance host.
+		{
+			match:    matchServerRegistry("GITEA_ACTIONS", "GITEA_SERVER_URL", "GITHUB_SERVER_URL"),
+			user:     []string{"GITEA_ACTOR", "GITHUB_ACTOR"},
+			password: []string{"GITEA_TOKEN", "GITHUB_TOKEN"},
+		},
+		// Forgejo Actions, likewise.
+		{
+			match:    matchServerRegistry("FORGEJO_ACTIONS", "FORGEJO_SERVER_URL", "GITHUB_SERVER_URL"),
+			user:     []string{"FORGEJO_ACTOR", "GITHUB_ACTOR"},
+			password: []string{"FORGEJO_TOKEN", "GITHUB_TOKEN"},
+		},
+	}
+)
+
+// firstEnv returns the first non-empty environment variable among names.
+func firstEnv(names []string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// matchEnvRegistry matches the registry whose host is given by the first
+// non-empty variable among names, if the detect variable is "true".
+func matchEnvRegistry(detect string, names ...string) func(RegistryClient) bool {
+	return func(r RegistryClient) bool {
+		if os.Getenv(detect) != "true" {
+			return false
+		}
+		host := firstEnv(names)
+		return host != "" && host == r.RegistryURL
+	}
+}
+
+// matchServerRegistry matches the registry served on the host of the instance
+// URL given by the first non-empty variable among names, if the detect
+// variable is "true".
+func matchServerRegistry(detect string, names ...string) func(RegistryClient) bool {
+	return func(r RegistryClient) bool {
+		if os.Getenv(detect) != "true" {
+			return false
+		}
+		u, err := url.Parse(firstEnv(names))
+		return err == nil && u.Host != "" && u.Host == r.RegistryURL
+	}
+}
+
+// getBearerTokenFromCI returns a bearer token obtained with the credentials
+// injected by the CI platform the registry belongs to, or notFound if there
+// are none.
+func (r RegistryClient) getBearerTokenFromCI(notFound error) (string, error) {
+	for _, ci := range ciPlatforms {
+		if !ci.match(r) {
+			continue
+		}
+		password := firstEnv(ci.password)
+		if password == "" {
+			continue
+		}
+		if ci.bearer {
+			return base64.StdEncoding.EncodeToString([]byte(password)), nil
+		}
+		user := firstEnv(ci.user)
+		if user == "" {
+			user = ci.defaultUser
+		}
+		return r.exchangeAuthToken(base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", user, password))))
+	}
+	return "", notFound
+}
+
+// ciEnvNames returns the environment variables consulted for credentials
+// injected by CI platforms handling the registry.
+func (r RegistryClient) ciEnvNames() []string {
+	var names []string
+	for _, ci := range ciPlatforms {
+		if ci.match(r) {
+			names = append(names, ci.user...)
+			names = append(names, ci.password...)
+		}
+	}
+	return names
+}
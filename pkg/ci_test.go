@@ -0,0 +1,172 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ciEnv lists the environment variables read by the CI platforms table.
+var ciEnv = []string{
+	"GITHUB_TOKEN", "GITHUB_ACTOR", "GITHUB_SERVER_URL",
+	"GITLAB_CI", "CI_REGISTRY", "CI_REGISTRY_USER", "CI_REGISTRY_PASSWORD", "CI_JOB_TOKEN",
+	"GITEA_ACTIONS", "GITEA_SERVER_URL", "GITEA_ACTOR", "GITEA_TOKEN",
+	"FORGEJO_ACTIONS", "FORGEJO_SERVER_URL", "FORGEJO_ACTOR", "FORGEJO_TOKEN",
+}
+
+func TestGetBearerTokenFromCI(t *testing.T) {
+	cases := []struct {
+		title        string
+		registryName string
+		// registryURL is the registry host, instead of the mock registry's.
+		registryURL string
+		// env values containing %s are formatted with the registry host.
+		env    map[string]string
+		expect string
+		isErr  bool
+	}{
+		{
+			title:       "GitHub",
+			registryURL: "ghcr.io",
+			env:         map[string]string{"GITHUB_TOKEN": "ghp_hogebearer"},
+			expect:      "Z2hwX2hvZ2ViZWFyZXI=",
+		},
+		{
+			title:        "GitHubCustomName",
+			registryName: "GHCR_ORG",
+			registryURL:  "ghcr.io",
+			env:          map[string]string{"GITHUB_TOKEN": "ghp_hogebearer"},
+			expect:       "Z2hwX2hvZ2ViZWFyZXI=",
+		},
+		{
+			title:        "GitHubOtherHostNamedGHCR",
+			registryName: "GHCR_IO",
+			env:          map[string]string{"GITHUB_TOKEN": "ghp_hogebearer"},
+			isErr:        true,
+		},
+		{
+			title: "GitLabJobToken",
+			env: map[string]string{
+				"GITLAB_CI":        "true",
+				"CI_REGISTRY":      "%s",
+				"CI_REGISTRY_USER": "hoge",
+				"CI_JOB_TOKEN":     "hige",
+			},
+			expect: "aG9nZWJlYXJlcg==",
+		},
+		{
+			title: "GitLabRegistryPassword",
+			env: map[string]string{
+				"GITLAB_CI":            "true",
+				"CI_REGISTRY":          "%s",
+				"CI_REGISTRY_USER":     "hoge",
+				"CI_REGISTRY_PASSWORD": "hige",
+				"CI_JOB_TOKEN":         "wrong",
+			},
+			expect: "aG9nZWJlYXJlcg==",
+		},
+		{
+			title: "GitLabOtherRegistry",
+			env: map[string]string{
+				"GITLAB_CI":        "true",
+				"CI_REGISTRY":      "registry.gitlab.com",
+				"CI_REGISTRY_USER": "hoge",
+				"CI_JOB_TOKEN":     "hige",
+			},
+			isErr: true,
+		},
+		{
+			title: "NotGitLab",
+			env: map[string]string{
+				"CI_REGISTRY":      "%s",
+				"CI_REGISTRY_USER": "hoge",
+				"CI_JOB_TOKEN":     "hige",
+			},
+			isErr: true,
+		},
+		{
+			title: "Gitea",
+			env: map[string]string{
+				"GITEA_ACTIONS":     "true",
+				"GITHUB_SERVER_URL": "https://%s/",
+				"GITHUB_ACTOR":      "hoge",
+				"GITEA_TOKEN":       "hige",
+			},
+			expect: "aG9nZWJlYXJlcg==",
+		},
+		{
+			title: "Forgejo",
+			env: map[string]string{
+				"FORGEJO_ACTIONS":    "true",
+				"FORGEJO_SERVER_URL": "https://%s",
+				"FORGEJO_ACTOR":      "hoge",
+				"FORGEJO_TOKEN":      "hige",
+			},
+			expect: "aG9nZWJlYXJlcg==",
+		},
+		{
+			title: "WrongCredentials",
+			env: map[string]string{
+				"FORGEJO_ACTIONS":    "true",
+				"FORGEJO_SERVER_URL": "https://%s",
+				"FORGEJO_ACTOR":      "hoge",
+				"FORGEJO_TOKEN":      "wrong",
+			},
+			isErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			t.Helper()
+			registry := mockRegistry{
+				t:      t,
+				scope:  "repository:hsn723/hoge:pull",
+				basic:  "aG9nZTpoaWdl",
+				bearer: "aG9nZWJlYXJlcg==",
+			}
+			registry.init()
+			url := registry.server.Listener.Addr().String()
+			for _, name := range ciEnv {
+				t.Setenv(name, "")
+			}
+			for k, v := range c.env {
+				if strings.Contains(v, "%s") {
+					v = fmt.Sprintf(v, url)
+				}
+				t.Setenv(k, v)
+			}
+			if c.registryURL != "" {
+				url = c.registryURL
+			}
+			registryName := c.registryName
+			if registryName == "" {
+				registryName = NormalizeRegistryName(url)
+			}
+			client := RegistryClient{
+				RegistryName: registryName,
+				RegistryURL:  url,
+				ImagePath:    "hsn723/hoge",
+				HttpClient:   http.DefaultClient,
+			}
+			actual, err := client.getBearerTokenFromCI(errors.New("not found"))
+			assertExpectedErr(t, err, c.isErr)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
+
+func TestCIEnvNames(t *testing.T) {
+	for _, name := range ciEnv {
+		t.Setenv(name, "")
+	}
+	t.Setenv("GITLAB_CI", "true")
+	t.Setenv("CI_REGISTRY", "registry.example.com")
+	client := RegistryClient{RegistryName: "REGISTRY_EXAMPLE_COM", RegistryURL: "registry.example.com"}
+	assert.Equal(t, []string{"CI_REGISTRY_USER", "CI_REGISTRY_PASSWORD", "CI_JOB_TOKEN"}, client.ciEnvNames())
+	client = RegistryClient{RegistryName: "GHCR_IO", RegistryURL: "ghcr.io"}
+	assert.Equal(t, []string{"GITHUB_TOKEN"}, client.ciEnvNames())
+}
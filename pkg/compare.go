@@ -0,0 +1,148 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+var (
+	manifestAcceptTypes = []string{
+		"application/vnd.oci.image.index.v1+json",
+		"application/vnd.docker.distribution.manifest.list.v2+json",
+		"application/vnd.oci.image.manifest.v1+json",
+		"application/vnd.docker.distribution.manifest.v2+json",
+	}
+)
+
+// ImageDigests holds the digest of a manifest and, if the manifest is an
+// image index, the digests of its per-platform manifests keyed by platform.
+type ImageDigests struct {
+	Digest    string            `json:"digest"`
+	MediaType string            `json:"mediaType"`
+	Platforms map[string]string `json:"platforms,omitempty"`
+	// Endpoint is the registry or mirror that answered.
+	Endpoint string `json:"endpoint"`
+	// PullLimit is the pull limit reported by the endpoint, if any.
+	PullLimit *PullLimit `json:"pullLimit,omitempty"`
+}
+
+// PlatformDiff describes a platform whose manifest differs between two images.
+// An empty digest means the platform is missing from that image.
+type PlatformDiff struct {
+	Platform          string `json:"platform"`
+	SourceDigest      string `json:"sourceDigest"`
+	DestinationDigest string `json:"destinationDigest"`
+}
+
+// Comparison is the result of comparing two images.
+type Comparison struct {
+	Identical bool           `json:"identical"`
+	Diverged  []PlatformDiff `json:"diverged,omitempty"`
+}
+
+func (r RegistryClient) fetchManifest(bearer, reference string) (http.Header, []byte, error) {
+	endpoint := fmt.Sprintf(manifestAPI, r.baseURL(), r.ImagePath, reference)
+	headers := map[string]string{
+		"Accept": strings.Join(manifestAcceptTypes, ", "),
+	}
+	if bearer != "" {
+		headers["Authorization"] = authorizationHeader(bearer)
+	}
+	status, header, res, err := r.retrieveWithHeader(http.MethodGet, endpoint, headers)
+	if err != nil {
+		return nil, nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, nil, fmt.Errorf("%s:%s not found", r.ImagePath, reference)
+	}
+	if status != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected response registry API: %d", status)
+	}
+	return header, res, nil
+}
+
+func (r RegistryClient) getDigests(reference string) (ImageDigests, error) {
+	var header http.Header
+	var res []byte
+	err := r.withAuth(func(bearer string) error {
+		var err error
+		header, res, err = r.fetchManifest(bearer, reference)
+		return err
+	})
+	if err != nil {
+		return ImageDigests{}, err
+	}
+	digests, err := parseImageDigests(header, res)
+	digests.Endpoint = r.RegistryURL
+	digests.PullLimit = parsePullLimit(header)
+	return digests, err
+}
+
+// GetDigests resolves the given tag or digest and returns the digest of its
+// manifest, along with per-platform manifest digests for image indexes.
+// Mirrors are not consulted, so that an image and its mirror can be compared.
+func (r RegistryClient) GetDigests(reference string) (ImageDigests, error) {
+	r.Mirrors = nil
+	return r.getDigests(reference)
+}
+
+func parseImageDigests(header http.Header, res []byte) (ImageDigests, error) {
+	var m struct {
+		MediaType string     `json:"mediaType"`
+		Manifests []manifest `json:"manifests"`
+	}
+	if err := json.Unmarshal(res, &m); err != nil {
+		return ImageDigests{}, err
+	}
+	digests := ImageDigests{
+		Digest:    header.Get("Docker-Content-Digest"),
+		MediaType: m.MediaType,
+	}
+	if digests.Digest == "" {
+		digests.Digest = fmt.Sprintf("sha256:%x", sha256.Sum256(res))
+	}
+	if digests.MediaType == "" {
+		digests.MediaType = header.Get("Content-Type")
+	}
+	if len(m.Manifests) == 0 {
+		return digests, nil
+	}
+	digests.Platforms = make(map[string]string, len(m.Manifests))
+	for _, child := range m.Manifests {
+		// Attestation manifests are attached as unknown/unknown and are not
+		// images in their own right.
+		if child.Platform.Os == "unknown" || child.Platform.Os == "" {
+			continue
+		}
+		digests.Platforms[child.Platform.String()] = child.Digest
+	}
+	return digests, nil
+}
+
+// CompareImages compares two images by digest. If the top-level digests
+// differ, the per-platform manifests are compared to report which platforms
+// diverge.
+func CompareImages(src, dst ImageDigests) Comparison {
+	if src.Digest == dst.Digest {
+		return Comparison{Identical: true}
+	}
+	var diverged []PlatformDiff
+	for p, d := range src.Platforms {
+		if dst.Platforms[p] != d {
+			diverged = append(diverged, PlatformDiff{Platform: p, SourceDigest: d, DestinationDigest: dst.Platforms[p]})
+		}
+	}
+	for p, d := range dst.Platforms {
+		if _, ok := src.Platforms[p]; !ok {
+			diverged = append(diverged, PlatformDiff{Platform: p, DestinationDigest: d})
+		}
+	}
+	sort.Slice(diverged, func(i, j int) bool {
+		return diverged[i].Platform < diverged[j].Platform
+	})
+	return Comparison{Diverged: diverged}
+}
@@ -0,0 +1,164 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetDigests(t *testing.T) {
+	cases := []struct {
+		title     string
+		bearerEnv string
+		path      string
+		registry  mockRegistry
+		reference string
+		expect    ImageDigests
+		isErr     bool
+	}{
+		{
+			title:     "Index",
+			bearerEnv: "aG9nZWJlYXJlcg==",
+			path:      "hsn723/hoge",
+			registry: mockRegistry{
+				t:        t,
+				bearer:   "aG9nZWJlYXJlcg==",
+				tags:     []string{"1.0.0"},
+				manifest: sampleManifest,
+			},
+			reference: "1.0.0",
+			expect: ImageDigests{
+				Digest:    "sha256:58b773b2f888498289db35ece6d1db28df010d452671378fd47fc3e1ff0a6981",
+				MediaType: "application/vnd.docker.distribution.manifest.list.v2+json",
+				Platforms: map[string]string{
+					"linux/amd64": "sha256:232479a01040fd2b02f10c568eb3860b52843f6a0c23a96e843ee80f22f3fdc7",
+					"linux/arm64": "sha256:9b6ce0b6aac841b356d19ebaad2860a849cf4b69b35a564f523eb1c3d07b3dea",
+				},
+			},
+		},
+		{
+			title: "SingleManifest",
+			path:  "hsn723/public-hoge",
+			registry: mockRegistry{
+				t:        t,
+				tags:     []string{"1.0.0"},
+				manifest: []byte(`{"mediaType":"application/vnd.oci.image.manifest.v1+json"}`),
+			},
+			reference: "1.0.0",
+			expect: ImageDigests{
+				Digest:    "sha256:0a1b17bf6d39f56897a7e8a056d930cf2bde38841a187aeb083d7487e2224573",
+				MediaType: "application/vnd.oci.image.manifest.v1+json",
+			},
+		},
+		{
+			title:     "NotFound",
+			bearerEnv: "aG9nZWJlYXJlcg==",
+			path:      "hsn723/hoge",
+			registry: mockRegistry{
+				t:      t,
+				bearer: "aG9nZWJlYXJlcg==",
+				tags:   []string{"1.0.0"},
+			},
+			reference: "2.0.0",
+			isErr:     true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			t.Helper()
+			c.registry.init()
+			url := c.registry.server.Listener.Addr().String()
+			client := RegistryClient{
+				RegistryName: NormalizeRegistryName(url),
+				RegistryURL:  url,
+				ImagePath:    c.path,
+				HttpClient:   http.DefaultClient,
+			}
+			t.Setenv(fmt.Sprintf("%s_TOKEN", client.RegistryName), c.bearerEnv)
+			if !c.isErr {
+				c.expect.Endpoint = url
+			}
+			actual, err := client.GetDigests(c.reference)
+			assertExpectedErr(t, err, c.isErr)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
+
+func TestGetDigestsIgnoresMirrors(t *testing.T) {
+	t.Parallel()
+	upstream := mockRegistry{
+		t:        t,
+		tags:     []string{"1.0.0"},
+		manifest: []byte(`{"mediaType":"application/vnd.oci.image.manifest.v1+json"}`),
+	}
+	upstream.init()
+	mirror := mockRegistry{
+		t:        t,
+		tags:     []string{"1.0.0"},
+		manifest: sampleManifest,
+	}
+	mirror.init()
+	url := upstream.server.Listener.Addr().String()
+	client := RegistryClient{
+		RegistryName: NormalizeRegistryName(url),
+		RegistryURL:  url,
+		ImagePath:    "hsn723/public-hoge",
+		HttpClient:   http.DefaultClient,
+		Mirrors:      []string{mirror.server.Listener.Addr().String()},
+	}
+	actual, err := client.GetDigests("1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:0a1b17bf6d39f56897a7e8a056d930cf2bde38841a187aeb083d7487e2224573", actual.Digest)
+	assert.Equal(t, url, actual.Endpoint)
+}
+
+func TestCompareImages(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title  string
+		src    ImageDigests
+		dst    ImageDigests
+		expect Comparison
+	}{
+		{
+			title:  "Identical",
+			src:    ImageDigests{Digest: "sha256:aaa", Platforms: map[string]string{"linux/amd64": "sha256:bbb"}},
+			dst:    ImageDigests{Digest: "sha256:aaa", Platforms: map[string]string{"linux/amd64": "sha256:bbb"}},
+			expect: Comparison{Identical: true},
+		},
+		{
+			title: "PlatformDiverged",
+			src:   ImageDigests{Digest: "sha256:aaa", Platforms: map[string]string{"linux/amd64": "sha256:bbb", "linux/arm64": "sha256:ccc"}},
+			dst:   ImageDigests{Digest: "sha256:ddd", Platforms: map[string]string{"linux/amd64": "sha256:bbb", "linux/arm64": "sha256:eee"}},
+			expect: Comparison{Diverged: []PlatformDiff{
+				{Platform: "linux/arm64", SourceDigest: "sha256:ccc", DestinationDigest: "sha256:eee"},
+			}},
+		},
+		{
+			title: "PlatformMissing",
+			src:   ImageDigests{Digest: "sha256:aaa", Platforms: map[string]string{"linux/amd64": "sha256:bbb", "linux/arm64": "sha256:ccc"}},
+			dst:   ImageDigests{Digest: "sha256:ddd", Platforms: map[string]string{"linux/amd64": "sha256:bbb", "linux/s390x": "sha256:fff"}},
+			expect: Comparison{Diverged: []PlatformDiff{
+				{Platform: "linux/arm64", SourceDigest: "sha256:ccc"},
+				{Platform: "linux/s390x", DestinationDigest: "sha256:fff"},
+			}},
+		},
+		{
+			title:  "SingleManifest",
+			src:    ImageDigests{Digest: "sha256:aaa"},
+			dst:    ImageDigests{Digest: "sha256:bbb"},
+			expect: Comparison{},
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			actual := CompareImages(tc.src, tc.dst)
+			assert.Equal(t, tc.expect, actual)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds defaults and per-registry settings read from a configuration file.
+type Config struct {
+	// Defaults holds the CA file, platforms, timeout, retry policy, proxy and
+	// rate limit used for registries that do not set them.
+	Defaults   RegistryConfig            `yaml:"defaults"`
+	Registries map[string]RegistryConfig `yaml:"registries"`
+}
+
+// RegistryConfig holds the settings for a registry.
+type RegistryConfig struct {
+	Credentials   CredentialsConfig `yaml:"credentials"`
+	Insecure      bool              `yaml:"insecure"`
+	PlainHTTP     bool              `yaml:"plainHTTP"`
+	CAFile        string            `yaml:"caFile"`
+	Mirrors       []string          `yaml:"mirrors"`
+	TokenEndpoint string            `yaml:"tokenEndpoint"`
+	Platforms     []string          `yaml:"platforms"`
+	Timeout       time.Duration     `yaml:"timeout"`
+	Retry         RetryPolicy       `yaml:"retry"`
+	// Proxy is the URL of the HTTP, HTTPS or SOCKS5 proxy used for the
+	// registry, optionally with credentials, or "direct" to bypass proxies.
+	// Proxies from the environment are used if unset.
+	Proxy string `yaml:"proxy"`
+	// RateLimit limits the rate and number of concurrent requests sent to
+	// each host of the registry, its mirrors and token endpoint.
+	RateLimit RateLimitConfig `yaml:"rateLimit"`
+}
+
+// CredentialsConfig describes where to look for registry credentials.
+type CredentialsConfig struct {
+	// Env is the name used in place of the normalized registry name when
+	// looking up credentials in environment variables.
+	Env string `yaml:"env"`
+	// Repositories maps repository prefixes to names used in place of Env for
+	// images under the longest matching prefix.
+	Repositories map[string]string `yaml:"repositories"`
+}
+
+// RetryPolicy describes how failed requests are retried.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts, including the first one.
+	Attempts int `yaml:"attempts"`
+	// Backoff is the delay before the first retry, doubled on each retry.
+	// The Retry-After header of 429 responses takes precedence.
+	Backoff time.Duration `yaml:"backoff"`
+	// MaxDelay caps the delay before each retry, including delays requested
+	// with Retry-After. Default is DefaultRetryMaxDelay.
+	MaxDelay time.Duration `yaml:"maxDelay"`
+}
+
+// DefaultRetryMaxDelay is the default cap on the delay before each retry.
+const DefaultRetryMaxDelay = 30 * time.Second
+
+func (p RetryPolicy) maxDelay() time.Duration {
+	if p.MaxDelay <= 0 {
+		return DefaultRetryMaxDelay
+	}
+	return p.MaxDelay
+}
+
+// DefaultConfigPath returns the path of the configuration file under
+// $XDG_CONFIG_HOME, or ~/.config if unset.
+func DefaultConfigPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "container-tag-exists", "config.yaml"), nil
+}
+
+// LoadConfig reads the configuration file at path. If optional is true, a
+// missing file results in an empty configuration instead of an error.
+func LoadConfig(path string, optional bool) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if optional && errors.Is(err, fs.ErrNotExist) {
+			return &Config{}, nil
+		}
+		return nil, err
+	}
+	var c Config
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ForRegistry returns the settings for the given registry, with unset CA
+// file, platforms, timeout, retry policy, proxy and rate limit taken from
+// the defaults.
+func (c *Config) ForRegistry(registryURL string) RegistryConfig {
+	rc := c.Registries[registryURL]
+	if rc.CAFile == "" {
+		rc.CAFile = c.Defaults.CAFile
+	}
+	if rc.Platforms == nil {
+		rc.Platforms = c.Defaults.Platforms
+	}
+	if rc.Timeout == 0 {
+		rc.Timeout = c.Defaults.Timeout
+	}
+	if rc.Retry.Attempts == 0 {
+		rc.Retry.Attempts = c.Defaults.Retry.Attempts
+	}
+	if rc.Retry.Backoff == 0 {
+		rc.Retry.Backoff = c.Defaults.Retry.Backoff
+	}
+	if rc.Retry.MaxDelay == 0 {
+		rc.Retry.MaxDelay = c.Defaults.Retry.MaxDelay
+	}
+	if rc.Proxy == "" {
+		rc.Proxy = c.Defaults.Proxy
+	}
+	if rc.RateLimit.RequestsPerSecond == 0 {
+		rc.RateLimit.RequestsPerSecond = c.Defaults.RateLimit.RequestsPerSecond
+	}
+	if rc.RateLimit.Burst == 0 {
+		rc.RateLimit.Burst = c.Defaults.RateLimit.Burst
+	}
+	if rc.RateLimit.MaxConcurrency == 0 {
+		rc.RateLimit.MaxConcurrency = c.Defaults.RateLimit.MaxConcurrency
+	}
+	return rc
+}
@@ -0,0 +1,128 @@
+package pkg
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title    string
+		path     string
+		optional bool
+		expect   *Config
+		isErr    bool
+	}{
+		{
+			title: "Sample",
+			path:  "t/config.yaml",
+			expect: &Config{
+				Defaults: RegistryConfig{
+					Platforms: []string{"linux/amd64"},
+					Timeout:   5 * time.Second,
+					Retry:     RetryPolicy{Attempts: 3, Backoff: time.Second, MaxDelay: 20 * time.Second},
+					Proxy:     "http://proxy.example.com:3128",
+					RateLimit: RateLimitConfig{MaxConcurrency: 8},
+				},
+				Registries: map[string]RegistryConfig{
+					"ghcr.io": {
+						Credentials: CredentialsConfig{Env: "GHCR_ORG", Repositories: map[string]string{"org-a": "GHCR_ORG_A"}},
+						Mirrors:     []string{"mirror.example.com"},
+						Platforms:   []string{"linux/arm64"},
+						Retry:       RetryPolicy{Attempts: 5},
+						RateLimit:   RateLimitConfig{RequestsPerSecond: 10, Burst: 5},
+					},
+					"registry.internal:5000": {
+						PlainHTTP:     true,
+						Insecure:      true,
+						TokenEndpoint: "https://auth.internal/token",
+						Timeout:       30 * time.Second,
+						Proxy:         "direct",
+					},
+				},
+			},
+		},
+		{
+			title:    "MissingOptional",
+			path:     filepath.Join(t.TempDir(), "config.yaml"),
+			optional: true,
+			expect:   &Config{},
+		},
+		{
+			title: "MissingRequired",
+			path:  filepath.Join(t.TempDir(), "config.yaml"),
+			isErr: true,
+		},
+		{
+			title: "Malformed",
+			path:  "t/sample.json",
+			isErr: true,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			actual, err := LoadConfig(c.path, c.optional)
+			assertExpectedErr(t, err, c.isErr)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
+
+func TestForRegistry(t *testing.T) {
+	t.Parallel()
+	config, err := LoadConfig("t/config.yaml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		title    string
+		registry string
+		expect   RegistryConfig
+	}{
+		{
+			title:    "PartialOverride",
+			registry: "ghcr.io",
+			expect: RegistryConfig{
+				Credentials: CredentialsConfig{Env: "GHCR_ORG", Repositories: map[string]string{"org-a": "GHCR_ORG_A"}},
+				Mirrors:     []string{"mirror.example.com"},
+				Platforms:   []string{"linux/arm64"},
+				Timeout:     5 * time.Second,
+				Retry:       RetryPolicy{Attempts: 5, Backoff: time.Second, MaxDelay: 20 * time.Second},
+				Proxy:       "http://proxy.example.com:3128",
+				RateLimit:   RateLimitConfig{RequestsPerSecond: 10, Burst: 5, MaxConcurrency: 8},
+			},
+		},
+		{
+			title:    "RegistryWithPort",
+			registry: "registry.internal:5000",
+			expect: RegistryConfig{
+				PlainHTTP:     true,
+				Insecure:      true,
+				TokenEndpoint: "https://auth.internal/token",
+				Platforms:     []string{"linux/amd64"},
+				Timeout:       30 * time.Second,
+				Retry:         RetryPolicy{Attempts: 3, Backoff: time.Second, MaxDelay: 20 * time.Second},
+				Proxy:         "direct",
+				RateLimit:     RateLimitConfig{MaxConcurrency: 8},
+			},
+		},
+		{
+			title:    "Unconfigured",
+			registry: "quay.io",
+			expect:   config.Defaults,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, c.expect, config.ForRegistry(c.registry))
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// credentialProvider obtains credentials for the registries of a platform,
+// such as a cloud provider, from that platform's own configuration.
+type credentialProvider interface {
+	// match returns true if the provider handles the registry.
+	match(registryURL string) bool
+	// credentials returns credentials for the registry.
+	credentials(r RegistryClient) (Credentials, error)
+	// envNames returns the environment variables the provider reads
+	// credentials from, besides those named after the registry.
+	envNames() []string
+}
+
+// providerEnvNames returns the environment variables consulted by the cloud
+// provider handling the registry, if any.
+func (r RegistryClient) providerEnvNames() []string {
+	if p, ok := r.adapter().(providerAdapter); ok {
+		return p.provider.envNames()
+	}
+	return nil
+}
+
+// getBearerTokenFromAdapter returns a bearer token obtained with the
+// credentials of the registry's adapter, or notFound if there are none.
+func (r RegistryClient) getBearerTokenFromAdapter(notFound error) (string, error) {
+	creds, err := r.adapter().Credentials(r)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case creds.Token != "":
+		return creds.Token, nil
+	case creds.RefreshToken != "":
+		return r.retrieveOAuth2Token(refreshTokenGrant(creds.RefreshToken))
+	case creds.AuthToken != "":
+		return r.exchangeAuthToken(creds.AuthToken)
+	}
+	return "", notFound
+}
+
+// matchesRepositoryPrefix returns true if the repository is prefix or lies
+// under it.
+func matchesRepositoryPrefix(repository, prefix string) bool {
+	return prefix != "" && (repository == prefix || strings.HasPrefix(repository, prefix+"/"))
+}
+
+// repositoryAliasSeparator separates the registry name from the alias in the
+// names of variables binding credentials to repositories.
+const repositoryAliasSeparator = "__REPO_"
+
+// isRepositoryAlias returns true if alias is made of uppercase letters and
+// digits only. Excluding "_" ensures that a variable name splits into a
+// registry name and an alias in a single way, so that variables meant for
+// registry.example.com:5000 are not mistaken for aliases of
+// registry.example.com.
+func isRepositoryAlias(alias string) bool {
+	if alias == "" {
+		return false
+	}
+	for _, c := range alias {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// repositoryCredentialName returns the name of the credentials bound to the
+// longest repository prefix matching the image, or "" if there is none.
+// Prefixes are taken from RepositoryCredentials, then from environment
+// variables named ${REGISTRY_NAME}__REPO_<ALIAS>, where ALIAS is made of
+// uppercase letters and digits, whose credentials are looked up with the
+// variable name as prefix.
+func (r RegistryClient) repositoryCredentialName() string {
+	var name, longest string
+	consider := func(prefix, n string) {
+		prefix = strings.Trim(prefix, "/")
+		if len(prefix) > len(longest) && matchesRepositoryPrefix(r.ImagePath, prefix) {
+			name, longest = n, prefix
+		}
+	}
+	for prefix, n := range r.RepositoryCredentials {
+		consider(prefix, n)
+	}
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		alias, ok := strings.CutPrefix(key, r.RegistryName+repositoryAliasSeparator)
+		if !ok || !isRepositoryAlias(alias) {
+			continue
+		}
+		consider(value, key)
+	}
+	return name
+}
+
+// credentialName returns the name credentials are looked up with first,
+// which also identifies cached tokens obtained with them.
+func (r RegistryClient) credentialName() string {
+	return r.envPrefixes()[0]
+}
+
+// envPrefixes returns the prefixes of the environment variables consulted for
+// credentials, in order. Credentials bound to the repository come first.
+// Legacy names are not consulted, as they may be the name of another
+// registry, such as MY_REGISTRY_IO for both my-registry.io and
+// my.registry.io.
+func (r RegistryClient) envPrefixes() []string {
+	if name := r.repositoryCredentialName(); name != "" {
+		return []string{name, r.RegistryName}
+	}
+	return []string{r.RegistryName}
+}
+
+// legacyEnvNames returns the credential variables set under the legacy name
+// of the registry, which are ignored.
+func (r RegistryClient) legacyEnvNames() []string {
+	if r.RegistryURL == "" || r.RegistryName != NormalizeRegistryName(r.RegistryURL) {
+		return nil
+	}
+	legacy := LegacyRegistryName(r.RegistryURL)
+	if legacy == r.RegistryName {
+		return nil
+	}
+	var names []string
+	for _, suffix := range credentialSuffixes {
+		name := fmt.Sprintf("%s_%s", legacy, suffix)
+		if os.Getenv(name) != "" || os.Getenv(name+"_FILE") != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// IgnoredLegacyEnv is a credential variable set under the legacy name of a
+// registry, which is ignored.
+type IgnoredLegacyEnv struct {
+	// Name is the variable under the legacy name.
+	Name string
+	// Current is the variable under the current name.
+	Current string
+}
+
+// IgnoredLegacyEnvs returns the credential variables set under the legacy
+// name of the registry while their counterparts under the current name are
+// not. Lookups ignore them and may therefore fall back to anonymous access,
+// so callers should warn about them.
+func (r RegistryClient) IgnoredLegacyEnvs() []IgnoredLegacyEnv {
+	legacy := LegacyRegistryName(r.RegistryURL)
+	var res []IgnoredLegacyEnv
+	for _, name := range r.legacyEnvNames() {
+		current := r.RegistryName + strings.TrimPrefix(name, legacy)
+		if envValue(current) == "" {
+			res = append(res, IgnoredLegacyEnv{Name: name, Current: current})
+		}
+	}
+	return res
+}
+
+// credentialSuffixes lists the suffixes of the environment variables holding
+// credentials, which can also be read from the file named by the variable
+// suffixed with _FILE.
+var credentialSuffixes = []string{"TOKEN", "REFRESH_TOKEN", "AUTH", "USER", "PASSWORD", "AAD_TOKEN"}
+
+// envValue returns the value of the environment variable name, or the
+// contents of the file named by name_FILE if unset, without surrounding
+// whitespace.
+func envValue(name string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return ""
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// checkCredentialFiles returns an error if a file named by a _FILE variable
+// in use cannot be read, so that a misconfigured secret mount is not
+// mistaken for missing credentials.
+func (r RegistryClient) checkCredentialFiles() error {
+	for _, prefix := range r.envPrefixes() {
+		for _, suffix := range credentialSuffixes {
+			name := fmt.Sprintf("%s_%s", prefix, suffix)
+			path := os.Getenv(name + "_FILE")
+			if path == "" || os.Getenv(name) != "" {
+				continue
+			}
+			if _, err := os.ReadFile(path); err != nil {
+				return fmt.Errorf("failed to read %s_FILE: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// getenv returns the first non-empty environment variable named after one of
+// the registry's prefixes and the given suffix, or the contents of the file
+// named by its _FILE counterpart.
+func (r RegistryClient) getenv(suffix string) string {
+	for _, prefix := range r.envPrefixes() {
+		if v := envValue(fmt.Sprintf("%s_%s", prefix, suffix)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// CredentialEnvNames returns the names of the environment variables consulted
+// for credentials, in the order they are consulted: variables named after
+// the registry, each followed by its _FILE counterpart, then those read by
+// the registry's cloud provider and CI platform.
+func (r RegistryClient) CredentialEnvNames() []string {
+	var names []string
+	add := func(prefix string, suffixes ...string) {
+		for _, suffix := range suffixes {
+			name := fmt.Sprintf("%s_%s", prefix, suffix)
+			names = append(names, name, name+"_FILE")
+		}
+	}
+	for _, suffix := range []string{"TOKEN", "REFRESH_TOKEN", "AUTH"} {
+		for _, prefix := range r.envPrefixes() {
+			add(prefix, suffix)
+		}
+	}
+	for _, prefix := range r.envPrefixes() {
+		add(prefix, "USER", "PASSWORD")
+	}
+	if (acrProvider{}).match(r.RegistryURL) {
+		for _, prefix := range r.envPrefixes() {
+			add(prefix, "AAD_TOKEN")
+		}
+	}
+	names = append(names, r.providerEnvNames()...)
+	names = append(names, r.ciEnvNames()...)
+	return names
+}
@@ -0,0 +1,314 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialEnvNames(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title  string
+		client RegistryClient
+		expect []string
+	}{
+		{
+			title:  "GHCR",
+			client: RegistryClient{RegistryName: "GHCR_IO", RegistryURL: "ghcr.io"},
+			expect: []string{
+				"GHCR_IO_TOKEN", "GHCR_IO_TOKEN_FILE", "GHCR_IO_REFRESH_TOKEN", "GHCR_IO_REFRESH_TOKEN_FILE", "GHCR_IO_AUTH", "GHCR_IO_AUTH_FILE",
+				"GHCR_IO_USER", "GHCR_IO_USER_FILE", "GHCR_IO_PASSWORD", "GHCR_IO_PASSWORD_FILE",
+				"GITHUB_TOKEN",
+			},
+		},
+		{
+			title:  "ACR",
+			client: RegistryClient{RegistryName: "HOGE_AZURECR_IO", RegistryURL: "hoge.azurecr.io"},
+			expect: []string{
+				"HOGE_AZURECR_IO_TOKEN", "HOGE_AZURECR_IO_TOKEN_FILE", "HOGE_AZURECR_IO_REFRESH_TOKEN", "HOGE_AZURECR_IO_REFRESH_TOKEN_FILE", "HOGE_AZURECR_IO_AUTH", "HOGE_AZURECR_IO_AUTH_FILE",
+				"HOGE_AZURECR_IO_USER", "HOGE_AZURECR_IO_USER_FILE", "HOGE_AZURECR_IO_PASSWORD", "HOGE_AZURECR_IO_PASSWORD_FILE",
+				"HOGE_AZURECR_IO_AAD_TOKEN", "HOGE_AZURECR_IO_AAD_TOKEN_FILE",
+				"AZURE_TENANT_ID", "AZURE_CLIENT_ID", "AZURE_CLIENT_SECRET",
+			},
+		},
+		{
+			title:  "ACRRepository",
+			client: RegistryClient{RegistryName: "HOGE_AZURECR_IO", RegistryURL: "hoge.azurecr.io", ImagePath: "team/hoge", RepositoryCredentials: map[string]string{"team": "HOGE_TEAM"}},
+			expect: []string{
+				"HOGE_TEAM_TOKEN", "HOGE_TEAM_TOKEN_FILE", "HOGE_AZURECR_IO_TOKEN", "HOGE_AZURECR_IO_TOKEN_FILE",
+				"HOGE_TEAM_REFRESH_TOKEN", "HOGE_TEAM_REFRESH_TOKEN_FILE", "HOGE_AZURECR_IO_REFRESH_TOKEN", "HOGE_AZURECR_IO_REFRESH_TOKEN_FILE",
+				"HOGE_TEAM_AUTH", "HOGE_TEAM_AUTH_FILE", "HOGE_AZURECR_IO_AUTH", "HOGE_AZURECR_IO_AUTH_FILE",
+				"HOGE_TEAM_USER", "HOGE_TEAM_USER_FILE", "HOGE_TEAM_PASSWORD", "HOGE_TEAM_PASSWORD_FILE",
+				"HOGE_AZURECR_IO_USER", "HOGE_AZURECR_IO_USER_FILE", "HOGE_AZURECR_IO_PASSWORD", "HOGE_AZURECR_IO_PASSWORD_FILE",
+				"HOGE_TEAM_AAD_TOKEN", "HOGE_TEAM_AAD_TOKEN_FILE", "HOGE_AZURECR_IO_AAD_TOKEN", "HOGE_AZURECR_IO_AAD_TOKEN_FILE",
+				"AZURE_TENANT_ID", "AZURE_CLIENT_ID", "AZURE_CLIENT_SECRET",
+			},
+		},
+		{
+			title:  "GCR",
+			client: RegistryClient{RegistryName: "GCR_IO", RegistryURL: "gcr.io"},
+			expect: []string{
+				"GCR_IO_TOKEN", "GCR_IO_TOKEN_FILE", "GCR_IO_REFRESH_TOKEN", "GCR_IO_REFRESH_TOKEN_FILE", "GCR_IO_AUTH", "GCR_IO_AUTH_FILE",
+				"GCR_IO_USER", "GCR_IO_USER_FILE", "GCR_IO_PASSWORD", "GCR_IO_PASSWORD_FILE",
+				"GOOGLE_APPLICATION_CREDENTIALS", "GCE_METADATA_HOST",
+			},
+		},
+		{
+			title:  "NoLegacyFallback",
+			client: RegistryClient{RegistryName: "MY__HOGE_DEV", RegistryURL: "my-hoge.dev"},
+			expect: []string{
+				"MY__HOGE_DEV_TOKEN", "MY__HOGE_DEV_TOKEN_FILE", "MY__HOGE_DEV_REFRESH_TOKEN", "MY__HOGE_DEV_REFRESH_TOKEN_FILE", "MY__HOGE_DEV_AUTH", "MY__HOGE_DEV_AUTH_FILE",
+				"MY__HOGE_DEV_USER", "MY__HOGE_DEV_USER_FILE", "MY__HOGE_DEV_PASSWORD", "MY__HOGE_DEV_PASSWORD_FILE",
+			},
+		},
+		{
+			title:  "CustomName",
+			client: RegistryClient{RegistryName: "HOGE", RegistryURL: "my-hoge.dev"},
+			expect: []string{
+				"HOGE_TOKEN", "HOGE_TOKEN_FILE", "HOGE_REFRESH_TOKEN", "HOGE_REFRESH_TOKEN_FILE", "HOGE_AUTH", "HOGE_AUTH_FILE",
+				"HOGE_USER", "HOGE_USER_FILE", "HOGE_PASSWORD", "HOGE_PASSWORD_FILE",
+			},
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, c.expect, c.client.CredentialEnvNames())
+		})
+	}
+}
+
+func TestGetenv(t *testing.T) {
+	cases := []struct {
+		title  string
+		env    map[string]string
+		expect string
+	}{
+		{
+			title:  "Current",
+			env:    map[string]string{"MY__HOGE_DEV_TOKEN": "hoge", "MY_HOGE_DEV_TOKEN": "hige"},
+			expect: "hoge",
+		},
+		{
+			title: "LegacyIgnored",
+			env:   map[string]string{"MY_HOGE_DEV_TOKEN": "hige"},
+		},
+		{
+			title: "Missing",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			t.Helper()
+			for k, v := range c.env {
+				t.Setenv(k, v)
+			}
+			client := RegistryClient{
+				RegistryName: NormalizeRegistryName("my-hoge.dev"),
+				RegistryURL:  "my-hoge.dev",
+			}
+			assert.Equal(t, c.expect, client.getenv("TOKEN"))
+		})
+	}
+}
+
+func TestLegacyNameCollision(t *testing.T) {
+	cases := []struct {
+		title   string
+		url     string
+		env     map[string]string
+		expect  string
+		legacy  []string
+		ignored []IgnoredLegacyEnv
+	}{
+		{
+			title:  "Dotted",
+			url:    "my.registry.io",
+			env:    map[string]string{"MY_REGISTRY_IO_TOKEN": "dotted"},
+			expect: "dotted",
+		},
+		{
+			title:  "Hyphenated",
+			url:    "my-registry.io",
+			env:    map[string]string{"MY_REGISTRY_IO_TOKEN": "dotted"},
+			legacy: []string{"MY_REGISTRY_IO_TOKEN"},
+			ignored: []IgnoredLegacyEnv{
+				{Name: "MY_REGISTRY_IO_TOKEN", Current: "MY__REGISTRY_IO_TOKEN"},
+			},
+		},
+		{
+			title:  "HyphenatedRenamed",
+			url:    "my-registry.io",
+			env:    map[string]string{"MY_REGISTRY_IO_TOKEN": "dotted", "MY__REGISTRY_IO_TOKEN": "hyphenated"},
+			expect: "hyphenated",
+			legacy: []string{"MY_REGISTRY_IO_TOKEN"},
+		},
+		{
+			title:  "HyphenatedPort",
+			url:    "localhost-5000",
+			env:    map[string]string{"LOCALHOST_5000_USER": "hoge", "LOCALHOST_5000_PASSWORD_FILE": "/dev/null"},
+			legacy: []string{"LOCALHOST_5000_USER", "LOCALHOST_5000_PASSWORD"},
+			ignored: []IgnoredLegacyEnv{
+				{Name: "LOCALHOST_5000_USER", Current: "LOCALHOST__5000_USER"},
+				{Name: "LOCALHOST_5000_PASSWORD", Current: "LOCALHOST__5000_PASSWORD"},
+			},
+		},
+		{
+			title:  "IPv4",
+			url:    "10.0.0.1:5000",
+			env:    map[string]string{"10_0_0_1_5000_TOKEN": "ipv4"},
+			legacy: []string{"10_0_0_1_5000_TOKEN"},
+			ignored: []IgnoredLegacyEnv{
+				{Name: "10_0_0_1_5000_TOKEN", Current: "_10_0_0_1_5000_TOKEN"},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			for k, v := range c.env {
+				t.Setenv(k, v)
+			}
+			client := RegistryClient{
+				RegistryName: NormalizeRegistryName(c.url),
+				RegistryURL:  c.url,
+			}
+			assert.Equal(t, c.expect, client.getenv("TOKEN"))
+			assert.Equal(t, c.legacy, client.legacyEnvNames())
+			assert.Equal(t, c.ignored, client.IgnoredLegacyEnvs())
+		})
+	}
+}
+
+func TestEnvPrefixesRepository(t *testing.T) {
+	cases := []struct {
+		title        string
+		imagePath    string
+		repositories map[string]string
+		env          map[string]string
+		expect       []string
+	}{
+		{
+			title:     "NoScope",
+			imagePath: "org-a/hoge",
+			expect:    []string{"GHCR_IO"},
+		},
+		{
+			title:        "Config",
+			imagePath:    "org-a/hoge",
+			repositories: map[string]string{"org-a": "ORG_A", "org-b": "ORG_B"},
+			expect:       []string{"ORG_A", "GHCR_IO"},
+		},
+		{
+			title:        "LongestPrefix",
+			imagePath:    "org-a/team/hoge",
+			repositories: map[string]string{"org-a": "ORG_A", "org-a/team/": "TEAM"},
+			expect:       []string{"TEAM", "GHCR_IO"},
+		},
+		{
+			title:        "SegmentBoundary",
+			imagePath:    "org-ab/hoge",
+			repositories: map[string]string{"org-a": "ORG_A"},
+			expect:       []string{"GHCR_IO"},
+		},
+		{
+			title:     "Env",
+			imagePath: "org-b/hoge",
+			env:       map[string]string{"GHCR_IO__REPO_A": "org-a", "GHCR_IO__REPO_B": "org-b"},
+			expect:    []string{"GHCR_IO__REPO_B", "GHCR_IO"},
+		},
+		{
+			title:        "EnvLongerThanConfig",
+			imagePath:    "org-a/team/hoge",
+			repositories: map[string]string{"org-a": "ORG_A"},
+			env:          map[string]string{"GHCR_IO__REPO_TEAM": "org-a/team"},
+			expect:       []string{"GHCR_IO__REPO_TEAM", "GHCR_IO"},
+		},
+		{
+			title:     "NoAlias",
+			imagePath: "org-a/hoge",
+			env:       map[string]string{"GHCR_IO__REPO_": "org-a"},
+			expect:    []string{"GHCR_IO"},
+		},
+		{
+			title:     "CredentialVariable",
+			imagePath: "org-a/hoge",
+			env:       map[string]string{"GHCR_IO__REPO_A_TOKEN": "org-a"},
+			expect:    []string{"GHCR_IO"},
+		},
+		{
+			title:     "OtherPort",
+			imagePath: "orga/hoge",
+			env:       map[string]string{"GHCR_IO_5000__REPO_ORGA": "orga"},
+			expect:    []string{"GHCR_IO"},
+		},
+		{
+			title:     "LegacySeparator",
+			imagePath: "orga/hoge",
+			env:       map[string]string{"GHCR_IO_5000_ORGA_REPOSITORY": "orga"},
+			expect:    []string{"GHCR_IO"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			t.Helper()
+			for k, v := range c.env {
+				t.Setenv(k, v)
+			}
+			client := RegistryClient{
+				RegistryName:          "GHCR_IO",
+				RegistryURL:           "ghcr.io",
+				ImagePath:             c.imagePath,
+				RepositoryCredentials: c.repositories,
+			}
+			assert.Equal(t, c.expect, client.envPrefixes())
+		})
+	}
+}
+
+func TestGetenvFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token")
+	if err := os.WriteFile(path, []byte("hoge\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		title  string
+		env    map[string]string
+		expect string
+		isErr  bool
+	}{
+		{
+			title:  "File",
+			env:    map[string]string{"GHCR_IO_TOKEN_FILE": path},
+			expect: "hoge",
+		},
+		{
+			title:  "VariableFirst",
+			env:    map[string]string{"GHCR_IO_TOKEN": "hige", "GHCR_IO_TOKEN_FILE": path},
+			expect: "hige",
+		},
+		{
+			title: "MissingFile",
+			env:   map[string]string{"GHCR_IO_TOKEN_FILE": filepath.Join(dir, "missing")},
+			isErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			t.Helper()
+			for k, v := range c.env {
+				t.Setenv(k, v)
+			}
+			client := RegistryClient{
+				RegistryName: "GHCR_IO",
+				RegistryURL:  "ghcr.io",
+			}
+			assertExpectedErr(t, client.checkCredentialFiles(), c.isErr)
+			assert.Equal(t, c.expect, client.getenv("TOKEN"))
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DialOverrides redirects connections to other addresses, like the --resolve
+// and --connect-to options of curl. Only the connection is redirected: the
+// Host header and the TLS server name still refer to the original host.
+type DialOverrides struct {
+	// resolve maps host:port to the addresses used in place of the
+	// resolved ones.
+	resolve map[string][]string
+	// connectTo lists host and port substitutions, applied before resolve.
+	connectTo []connectTo
+}
+
+// connectTo substitutes host and port. Empty fields of the source match any
+// host or port, and empty fields of the destination are left unchanged.
+type connectTo struct {
+	fromHost, fromPort string
+	toHost, toPort     string
+}
+
+// cutField returns the first colon-separated field of s and the rest, with
+// IPv6 literals enclosed in brackets kept whole and unbracketed. It returns
+// false if no colon follows the field.
+func cutField(s string) (string, string, bool) {
+	if strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]")
+		if end < 0 || !strings.HasPrefix(s[end+1:], ":") {
+			return "", "", false
+		}
+		return s[1:end], s[end+2:], true
+	}
+	return strings.Cut(s, ":")
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
+// ParseDialOverrides parses --resolve entries in the format
+// HOST:PORT:ADDR[,ADDR]... and --connect-to entries in the format
+// HOST1:PORT1:HOST2:PORT2.
+func ParseDialOverrides(resolve, connect []string) (*DialOverrides, error) {
+	o := &DialOverrides{resolve: make(map[string][]string)}
+	for _, entry := range resolve {
+		host, rest, ok := cutField(entry)
+		port, addrs, hasAddrs := strings.Cut(rest, ":")
+		if !ok || !hasAddrs || host == "" || !validPort(port) || addrs == "" {
+			return nil, fmt.Errorf("malformed resolve entry %q, expected HOST:PORT:ADDR[,ADDR]...", entry)
+		}
+		var ips []string
+		for _, addr := range strings.Split(addrs, ",") {
+			addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+			if net.ParseIP(addr) == nil {
+				return nil, fmt.Errorf("malformed resolve entry %q: %q is not an IP address", entry, addr)
+			}
+			ips = append(ips, addr)
+		}
+		key := net.JoinHostPort(strings.ToLower(host), port)
+		o.resolve[key] = append(o.resolve[key], ips...)
+	}
+	for _, entry := range connect {
+		fromHost, rest, ok1 := cutField(entry)
+		fromPort, rest, ok2 := strings.Cut(rest, ":")
+		toHost, toPort, ok3 := cutField(rest)
+		if !ok1 || !ok2 || !ok3 || (fromPort != "" && !validPort(fromPort)) || (toPort != "" && !validPort(toPort)) {
+			return nil, fmt.Errorf("malformed connect-to entry %q, expected HOST1:PORT1:HOST2:PORT2", entry)
+		}
+		o.connectTo = append(o.connectTo, connectTo{
+			fromHost: fromHost,
+			fromPort: fromPort,
+			toHost:   toHost,
+			toPort:   toPort,
+		})
+	}
+	return o, nil
+}
+
+// target returns the addresses to dial in place of addr.
+func (o *DialOverrides) target(addr string) ([]string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range o.connectTo {
+		if (c.fromHost != "" && !strings.EqualFold(c.fromHost, host)) || (c.fromPort != "" && c.fromPort != port) {
+			continue
+		}
+		if c.toHost != "" {
+			host = c.toHost
+		}
+		if c.toPort != "" {
+			port = c.toPort
+		}
+		break
+	}
+	ips, ok := o.resolve[net.JoinHostPort(strings.ToLower(host), port)]
+	if !ok {
+		return []string{net.JoinHostPort(host, port)}, nil
+	}
+	targets := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		targets = append(targets, net.JoinHostPort(ip, port))
+	}
+	return targets, nil
+}
+
+// DialContext returns a dial function for http.Transport connecting with
+// dialer to the overridden addresses, tried in order.
+func (o *DialOverrides) DialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		targets, err := o.target(addr)
+		if err != nil {
+			return nil, err
+		}
+		var conn net.Conn
+		for _, target := range targets {
+			if conn, err = dialer.DialContext(ctx, network, target); err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
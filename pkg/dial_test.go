@@ -0,0 +1,149 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDialOverrides(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title   string
+		resolve []string
+		connect []string
+		isErr   bool
+	}{
+		{
+			title:   "Valid",
+			resolve: []string{"registry.example.com:443:10.0.0.1,10.0.0.2", "[::1]:5000:[::1]"},
+			connect: []string{"registry.example.com:443:replica.example.com:8443", "::backend:", "[::1]:5000:[fe80::1]:5001"},
+		},
+		{
+			title:   "ResolveMissingAddress",
+			resolve: []string{"registry.example.com:443"},
+			isErr:   true,
+		},
+		{
+			title:   "ResolveHostname",
+			resolve: []string{"registry.example.com:443:replica.example.com"},
+			isErr:   true,
+		},
+		{
+			title:   "ResolveInvalidPort",
+			resolve: []string{"registry.example.com:https:10.0.0.1"},
+			isErr:   true,
+		},
+		{
+			title:   "ConnectToMissingField",
+			connect: []string{"registry.example.com:443:replica.example.com"},
+			isErr:   true,
+		},
+		{
+			title:   "ConnectToInvalidPort",
+			connect: []string{"registry.example.com:443:replica.example.com:hoge"},
+			isErr:   true,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			_, err := ParseDialOverrides(c.resolve, c.connect)
+			assertExpectedErr(t, err, c.isErr)
+		})
+	}
+}
+
+func TestDialOverridesTarget(t *testing.T) {
+	t.Parallel()
+	o, err := ParseDialOverrides(
+		[]string{"registry.example.com:443:10.0.0.1,10.0.0.2", "replica.example.com:8443:10.0.0.3", "[::1]:5000:[fe80::1]"},
+		[]string{"mirror.example.com:443:replica.example.com:8443", ":5001::5000"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		title  string
+		addr   string
+		expect []string
+	}{
+		{
+			title:  "Resolve",
+			addr:   "Registry.example.com:443",
+			expect: []string{"10.0.0.1:443", "10.0.0.2:443"},
+		},
+		{
+			title:  "ResolveOtherPort",
+			addr:   "registry.example.com:5000",
+			expect: []string{"registry.example.com:5000"},
+		},
+		{
+			title:  "ConnectToThenResolve",
+			addr:   "mirror.example.com:443",
+			expect: []string{"10.0.0.3:8443"},
+		},
+		{
+			title:  "ConnectToAnyHost",
+			addr:   "hoge.example.com:5001",
+			expect: []string{"hoge.example.com:5000"},
+		},
+		{
+			title:  "IPv6",
+			addr:   "[::1]:5000",
+			expect: []string{"[fe80::1]:5000"},
+		},
+		{
+			title:  "Untouched",
+			addr:   "ghcr.io:443",
+			expect: []string{"ghcr.io:443"},
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			actual, err := o.target(c.addr)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
+
+func TestDialOverridesDialContext(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := fmt.Sprintf("registry.invalid:%s", port)
+	// The first address is unreachable, so that the second one is tried.
+	o, err := ParseDialOverrides([]string{fmt.Sprintf("%s:192.0.2.1,127.0.0.1", host)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: o.DialContext(&net.Dialer{Timeout: 100 * time.Millisecond}),
+		},
+	}
+	res, err := client.Get(fmt.Sprintf("http://%s/", host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, host, string(body))
+}
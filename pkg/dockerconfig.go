@@ -0,0 +1,84 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dockerConfig is the subset of the docker client configuration file holding
+// registry credentials.
+type dockerConfig struct {
+	Auths map[string]dockerAuth `json:"auths"`
+}
+
+type dockerAuth struct {
+	Auth          string `json:"auth,omitempty"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+	RegistryToken string `json:"registrytoken,omitempty"`
+}
+
+// dockerConfigPath returns the path of the docker client configuration file,
+// under $DOCKER_CONFIG or ~/.docker.
+func dockerConfigPath() (string, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+func loadDockerConfig() (dockerConfig, error) {
+	path, err := dockerConfigPath()
+	if err != nil {
+		return dockerConfig{}, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return dockerConfig{}, err
+	}
+	var c dockerConfig
+	if err := json.Unmarshal(b, &c); err != nil {
+		return dockerConfig{}, err
+	}
+	return c, nil
+}
+
+// lookup returns the credentials for the registry. Keys in the auths section
+// may be bare hosts or URLs, and Docker Hub is keyed by its legacy index URL.
+func (c dockerConfig) lookup(registryURL string) (dockerAuth, bool) {
+	if registryURL == "docker.io" || registryURL == "index.docker.io" {
+		if auth, ok := c.Auths["https://index.docker.io/v1/"]; ok {
+			return auth, true
+		}
+	}
+	for key, auth := range c.Auths {
+		host := strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+		host, _, _ = strings.Cut(host, "/")
+		if host == registryURL {
+			return auth, true
+		}
+	}
+	return dockerAuth{}, false
+}
+
+// authToken returns the basic auth token of the credentials, or "" if they
+// hold none.
+func (a dockerAuth) authToken() string {
+	if a.Auth != "" {
+		return a.Auth
+	}
+	if a.Username == "" || a.Password == "" {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", a.Username, a.Password)))
+}
@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDockerConfigLookup(t *testing.T) {
+	t.Parallel()
+	config := dockerConfig{
+		Auths: map[string]dockerAuth{
+			"ghcr.io":                     {Auth: "aG9nZTpoaWdl"},
+			"https://registry.dev:3000":   {IdentityToken: "aG9nZXJlZnJlc2g="},
+			"https://index.docker.io/v1/": {Username: "hoge", Password: "hige"},
+		},
+	}
+	cases := []struct {
+		title    string
+		registry string
+		expect   dockerAuth
+		found    bool
+	}{
+		{
+			title:    "Host",
+			registry: "ghcr.io",
+			expect:   dockerAuth{Auth: "aG9nZTpoaWdl"},
+			found:    true,
+		},
+		{
+			title:    "URLWithPort",
+			registry: "registry.dev:3000",
+			expect:   dockerAuth{IdentityToken: "aG9nZXJlZnJlc2g="},
+			found:    true,
+		},
+		{
+			title:    "DockerHub",
+			registry: "docker.io",
+			expect:   dockerAuth{Username: "hoge", Password: "hige"},
+			found:    true,
+		},
+		{
+			title:    "Missing",
+			registry: "quay.io",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			actual, found := config.lookup(c.registry)
+			assert.Equal(t, c.found, found)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
+
+func TestGetRefreshToken(t *testing.T) {
+	cases := []struct {
+		title  string
+		env    string
+		config string
+		expect string
+	}{
+		{
+			title:  "Env",
+			env:    "aG9nZXJlZnJlc2g=",
+			config: `{"auths":{"registry.dev":{"identitytoken":"aGlnZXJlZnJlc2g="}}}`,
+			expect: "aG9nZXJlZnJlc2g=",
+		},
+		{
+			title:  "DockerConfig",
+			config: `{"auths":{"registry.dev":{"identitytoken":"aGlnZXJlZnJlc2g="}}}`,
+			expect: "aGlnZXJlZnJlc2g=",
+		},
+		{
+			title:  "Missing",
+			config: `{"auths":{"registry.dev":{"auth":"aG9nZTpoaWdl"}}}`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			t.Helper()
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(c.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("DOCKER_CONFIG", dir)
+			t.Setenv("REGISTRY_DEV_REFRESH_TOKEN", c.env)
+			client := RegistryClient{
+				RegistryName: "REGISTRY_DEV",
+				RegistryURL:  "registry.dev",
+			}
+			assert.Equal(t, c.expect, client.getRefreshToken())
+		})
+	}
+}
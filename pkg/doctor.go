@@ -0,0 +1,347 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Kinds of credential sources.
+const (
+	SourceEnv          = "env"
+	SourcePullSecret   = "pull-secret"
+	SourceTokenCache   = "token-cache"
+	SourceDockerConfig = "docker-config"
+	SourceAdapter      = "adapter"
+	SourceCI           = "ci"
+)
+
+// CredentialSource describes a place credentials are looked up in. Secrets
+// are never included.
+type CredentialSource struct {
+	// Name identifies the source, such as an environment variable.
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Found is true if the source holds credentials.
+	Found bool `json:"found"`
+	// Detail tells where credentials were read from, or why the source
+	// cannot be used.
+	Detail string `json:"detail,omitempty"`
+}
+
+// AuthAttempt is the result of requesting the manifest of a tag with one of
+// the authentication methods tried in turn by tag lookups.
+type AuthAttempt struct {
+	// Method is anonymous, anonymous_token or credentials.
+	Method string `json:"method"`
+	// OK is true if access was granted, whether or not the tag exists.
+	OK     bool   `json:"ok"`
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Scheme is the authorization scheme the token was sent with.
+	Scheme string `json:"scheme,omitempty"`
+	// Claims are the claims of the token, if it is a JWT.
+	Claims *TokenClaims `json:"claims,omitempty"`
+}
+
+// Diagnosis explains how credentials are resolved for an image and why
+// access fails.
+type Diagnosis struct {
+	Registry string `json:"registry"`
+	// RegistryName is the name credentials are looked up with, and
+	// NormalizedName the name derived from the registry, which differ if the
+	// name was configured.
+	RegistryName   string `json:"registryName"`
+	NormalizedName string `json:"normalizedName"`
+	// CredentialName is the name credentials bound to the repository are
+	// looked up with, if any.
+	CredentialName string             `json:"credentialName,omitempty"`
+	Repository     string             `json:"repository"`
+	Tag            string             `json:"tag"`
+	Sources        []CredentialSource `json:"sources"`
+	Attempts       []AuthAttempt      `json:"attempts"`
+	Suggestions    []string           `json:"suggestions,omitempty"`
+}
+
+// envSource reports whether the environment variable, or the file named by
+// its _FILE counterpart, is set.
+func envSource(name string) CredentialSource {
+	s := CredentialSource{Name: name, Kind: SourceEnv}
+	if os.Getenv(name) != "" {
+		s.Found = true
+		return s
+	}
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return s
+	}
+	s.Name = name + "_FILE"
+	if _, err := os.ReadFile(path); err != nil {
+		s.Detail = err.Error()
+		return s
+	}
+	if envValue(name) == "" {
+		s.Detail = fmt.Sprintf("%s is empty", path)
+		return s
+	}
+	s.Found = true
+	s.Detail = fmt.Sprintf("read from %s", path)
+	return s
+}
+
+func (r RegistryClient) envSources(suffix string) []CredentialSource {
+	var sources []CredentialSource
+	for _, prefix := range r.envPrefixes() {
+		sources = append(sources, envSource(fmt.Sprintf("%s_%s", prefix, suffix)))
+	}
+	return sources
+}
+
+func (r RegistryClient) pullSecretSource(field string, found func(dockerAuth) bool) []CredentialSource {
+	if r.PullSecret == nil {
+		return nil
+	}
+	s := CredentialSource{Name: fmt.Sprintf("pull secret %s", field), Kind: SourcePullSecret}
+	if auth, ok := r.pullSecretAuth(); ok {
+		s.Found = found(auth)
+	} else {
+		s.Detail = fmt.Sprintf("no entry for %s", r.RegistryURL)
+	}
+	return []CredentialSource{s}
+}
+
+func (r RegistryClient) dockerConfigSource() CredentialSource {
+	s := CredentialSource{Name: "docker config identitytoken", Kind: SourceDockerConfig}
+	path, err := dockerConfigPath()
+	if err != nil {
+		s.Detail = err.Error()
+		return s
+	}
+	s.Name = fmt.Sprintf("%s identitytoken", path)
+	config, err := loadDockerConfig()
+	if err != nil {
+		s.Detail = err.Error()
+		return s
+	}
+	auth, ok := config.lookup(r.RegistryURL)
+	switch {
+	case !ok:
+		s.Detail = fmt.Sprintf("no entry for %s", r.RegistryURL)
+	case auth.IdentityToken != "":
+		s.Found = true
+	case auth.authToken() != "":
+		s.Detail = "only identity tokens are used, not the basic auth credentials of the entry"
+	}
+	return s
+}
+
+func (r RegistryClient) adapterSources() []CredentialSource {
+	var sources []CredentialSource
+	if (acrProvider{}).match(r.RegistryURL) {
+		sources = append(sources, envSource(fmt.Sprintf("%s_AAD_TOKEN", r.RegistryName)))
+	}
+	s := CredentialSource{Name: "registry adapter", Kind: SourceAdapter}
+	if p, ok := r.adapter().(providerAdapter); ok {
+		switch p.provider.(type) {
+		case ecrProvider:
+			s.Name = "Amazon ECR"
+		case gcrProvider:
+			s.Name = "Google Cloud"
+		case acrProvider:
+			s.Name = "Azure"
+		}
+	}
+	creds, err := r.adapter().Credentials(r)
+	switch {
+	case err != nil:
+		s.Detail = err.Error()
+	case creds.Token != "":
+		s.Found, s.Detail = true, "bearer token"
+	case creds.RefreshToken != "":
+		s.Found, s.Detail = true, "refresh token"
+	case creds.AuthToken != "":
+		s.Found, s.Detail = true, "basic auth credentials"
+	default:
+		// Adapters without credentials, such as Docker Hub's, are not
+		// worth listing.
+		return sources
+	}
+	return append(sources, s)
+}
+
+func (r RegistryClient) ciSources() []CredentialSource {
+	var sources []CredentialSource
+	for _, ci := range ciPlatforms {
+		if !ci.match(r) {
+			continue
+		}
+		for _, name := range ci.user {
+			s := CredentialSource{Name: name, Kind: SourceCI, Found: os.Getenv(name) != ""}
+			if !s.Found && ci.defaultUser != "" {
+				s.Detail = fmt.Sprintf("defaults to %s", ci.defaultUser)
+			}
+			sources = append(sources, s)
+		}
+		for _, name := range ci.password {
+			sources = append(sources, CredentialSource{Name: name, Kind: SourceCI, Found: os.Getenv(name) != ""})
+		}
+	}
+	return sources
+}
+
+// CredentialSources lists the sources consulted for credentials, in the
+// order they are consulted, and whether they hold credentials. Credentials
+// of registry adapters, such as cloud provider credentials, are obtained to
+// tell whether they are available.
+func (r RegistryClient) CredentialSources() []CredentialSource {
+	sources := r.envSources("TOKEN")
+	sources = append(sources, r.pullSecretSource("registrytoken", func(a dockerAuth) bool { return a.RegistryToken != "" })...)
+	if r.TokenCache != nil {
+		sources = append(sources, CredentialSource{
+			Name:  "token cache",
+			Kind:  SourceTokenCache,
+			Found: r.cachedToken(r.credentialName()) != "",
+		})
+	}
+	sources = append(sources, r.envSources("REFRESH_TOKEN")...)
+	sources = append(sources, r.pullSecretSource("identitytoken", func(a dockerAuth) bool { return a.IdentityToken != "" })...)
+	sources = append(sources, r.dockerConfigSource())
+	sources = append(sources, r.envSources("AUTH")...)
+	for _, prefix := range r.envPrefixes() {
+		sources = append(sources, envSource(fmt.Sprintf("%s_USER", prefix)), envSource(fmt.Sprintf("%s_PASSWORD", prefix)))
+	}
+	sources = append(sources, r.pullSecretSource("auth", func(a dockerAuth) bool { return a.authToken() != "" })...)
+	sources = append(sources, r.adapterSources()...)
+	return append(sources, r.ciSources()...)
+}
+
+// attempt requests the manifest of the tag with the token, if any.
+func (r RegistryClient) attempt(method, token, tag string) AuthAttempt {
+	a := AuthAttempt{Method: method}
+	headers := map[string]string{
+		"Accept": strings.Join(manifestAcceptTypes, ", "),
+	}
+	if token != "" {
+		headers["Authorization"] = authorizationHeader(token)
+		scheme, credentials, _ := strings.Cut(headers["Authorization"], " ")
+		a.Scheme = strings.ToLower(scheme)
+		if a.Scheme == "bearer" {
+			a.Claims, _ = decodeTokenClaims(credentials)
+		}
+	}
+	status, _, err := r.retrieve(http.MethodHead, fmt.Sprintf(manifestAPI, r.baseURL(), r.ImagePath, tag), headers)
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	a.Status = status
+	a.OK = status == http.StatusOK || status == http.StatusNotFound
+	return a
+}
+
+// Diagnose lists the credential sources for the image, requests the
+// manifest of the tag anonymously, with an anonymous token and with
+// credentials, and suggests how to fix failures. Mirrors are not consulted.
+func (r RegistryClient) Diagnose(tag string) Diagnosis {
+	r.Mirrors = nil
+	r = r.withChallengeCache()
+	d := Diagnosis{
+		Registry:       r.RegistryURL,
+		RegistryName:   r.RegistryName,
+		NormalizedName: NormalizeRegistryName(r.RegistryURL),
+		CredentialName: r.repositoryCredentialName(),
+		Repository:     r.ImagePath,
+		Tag:            tag,
+		Sources:        r.CredentialSources(),
+	}
+	d.Attempts = append(d.Attempts, r.attempt(authMethodAnonymous, "", tag))
+	if token, err := r.getAnonymousToken(); err != nil {
+		d.Attempts = append(d.Attempts, AuthAttempt{Method: authMethodAnonymousToken, Error: err.Error()})
+	} else {
+		d.Attempts = append(d.Attempts, r.attempt(authMethodAnonymousToken, token, tag))
+	}
+	if token, err := r.getBearerToken(); err != nil {
+		d.Attempts = append(d.Attempts, AuthAttempt{Method: authMethodCredentials, Error: err.Error()})
+	} else {
+		d.Attempts = append(d.Attempts, r.attempt(authMethodCredentials, token, tag))
+	}
+	d.Suggestions = r.suggest(d, time.Now())
+	return d
+}
+
+// suggest returns suggestions for fixing the failures in the diagnosis.
+func (r RegistryClient) suggest(d Diagnosis, now time.Time) []string {
+	var suggestions []string
+	var used *CredentialSource
+	for i, s := range d.Sources {
+		if s.Found && used == nil {
+			used = &d.Sources[i]
+		}
+		if s.Kind == SourceEnv && strings.HasSuffix(s.Name, "_FILE") && !s.Found {
+			suggestions = append(suggestions, fmt.Sprintf("%s cannot be used: %s", s.Name, s.Detail))
+		}
+	}
+	found := make(map[string]bool)
+	for _, s := range d.Sources {
+		found[strings.TrimSuffix(s.Name, "_FILE")] = s.Found
+	}
+	for _, prefix := range r.envPrefixes() {
+		user, pass := prefix+"_USER", prefix+"_PASSWORD"
+		if found[user] != found[pass] {
+			suggestions = append(suggestions, fmt.Sprintf("set both %s and %s", user, pass))
+		}
+	}
+	legacy := LegacyRegistryName(r.RegistryURL)
+	for _, name := range r.legacyEnvNames() {
+		suggestions = append(suggestions, fmt.Sprintf("%s uses the legacy name %s and is ignored, as it may belong to another registry, rename it to %s if it is meant for %s", name, legacy, r.RegistryName+strings.TrimPrefix(name, legacy), r.RegistryURL))
+	}
+
+	anonymous, anonymousToken, credentials := d.Attempts[0], d.Attempts[1], d.Attempts[2]
+	if anonymous.Error != "" && anonymous.Status == 0 && anonymousToken.Status == 0 && credentials.Status == 0 {
+		return append(suggestions, fmt.Sprintf("%s could not be reached, check the network and proxy settings, or run the ping command", r.RegistryURL))
+	}
+	public := anonymous.OK || anonymousToken.OK
+	switch {
+	case credentials.Error != "" && used == nil:
+		if !public {
+			suggestions = append(suggestions, fmt.Sprintf("no credentials were found, set %s_USER and %s_PASSWORD, or %s_TOKEN, or run the registry-name command for all variables", r.RegistryName, r.RegistryName, r.RegistryName))
+		}
+	case credentials.Error != "":
+		suggestions = append(suggestions, fmt.Sprintf("credentials from %s could not be used: %s", used.Name, credentials.Error))
+	case credentials.Status == http.StatusUnauthorized:
+		suggestions = append(suggestions, fmt.Sprintf("%s rejected the credentials from %s, check that they are valid", r.RegistryURL, sourceName(used)))
+	}
+	if c := credentials.Claims; c != nil {
+		if c.Expiry != nil && now.After(*c.Expiry) {
+			suggestions = append(suggestions, fmt.Sprintf("the token from %s expired at %s, renew it", sourceName(used), c.Expiry.Format(time.RFC3339)))
+		}
+		if !credentials.OK && !c.grants(r.ImagePath, "pull") {
+			suggestions = append(suggestions, fmt.Sprintf("the token does not grant pull access to %s, check the permissions of the account", r.ImagePath))
+		}
+	}
+	if credentials.Status == http.StatusForbidden {
+		suggestions = append(suggestions, fmt.Sprintf("the credentials from %s are valid but lack pull access to %s", sourceName(used), r.ImagePath))
+	}
+	if public && !credentials.OK {
+		suggestions = append(suggestions, fmt.Sprintf("%s is public, credentials are not needed", r.ImagePath))
+	}
+	granted := false
+	tagFound := false
+	for _, a := range d.Attempts {
+		granted = granted || a.OK
+		tagFound = tagFound || a.Status == http.StatusOK
+	}
+	if granted && !tagFound {
+		suggestions = append(suggestions, fmt.Sprintf("access to %s works but the tag %s does not exist", r.ImagePath, d.Tag))
+	}
+	return suggestions
+}
+
+func sourceName(s *CredentialSource) string {
+	if s == nil {
+		return "the environment"
+	}
+	return s.Name
+}
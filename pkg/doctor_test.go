@@ -0,0 +1,189 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialSources(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+	config := `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("hogetoken\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("REGISTRY_EXAMPLE_COM_TOKEN_FILE", tokenFile)
+	t.Setenv("REGISTRY_EXAMPLE_COM_AUTH_FILE", filepath.Join(dir, "missing"))
+	t.Setenv("REGISTRY_EXAMPLE_COM_USER", "hsn723")
+
+	client := RegistryClient{
+		RegistryName: "REGISTRY_EXAMPLE_COM",
+		RegistryURL:  "registry.example.com",
+		ImagePath:    "hsn723/hoge",
+		TokenCache:   NewTokenCache(),
+	}
+	sources := client.CredentialSources()
+	assert.Equal(t, []CredentialSource{
+		{Name: "REGISTRY_EXAMPLE_COM_TOKEN_FILE", Kind: SourceEnv, Found: true, Detail: fmt.Sprintf("read from %s", tokenFile)},
+		{Name: "token cache", Kind: SourceTokenCache},
+		{Name: "REGISTRY_EXAMPLE_COM_REFRESH_TOKEN", Kind: SourceEnv},
+		{Name: fmt.Sprintf("%s identitytoken", filepath.Join(dir, "config.json")), Kind: SourceDockerConfig, Detail: "only identity tokens are used, not the basic auth credentials of the entry"},
+		{Name: "REGISTRY_EXAMPLE_COM_AUTH_FILE", Kind: SourceEnv, Detail: fmt.Sprintf("open %s: no such file or directory", filepath.Join(dir, "missing"))},
+		{Name: "REGISTRY_EXAMPLE_COM_USER", Kind: SourceEnv, Found: true},
+		{Name: "REGISTRY_EXAMPLE_COM_PASSWORD", Kind: SourceEnv},
+	}, sources)
+
+	suggestions := client.suggest(Diagnosis{
+		Sources: sources,
+		Attempts: []AuthAttempt{
+			{Method: authMethodAnonymous, Status: http.StatusUnauthorized},
+			{Method: authMethodAnonymousToken, Error: "unsupported authentication scheme"},
+			{Method: authMethodCredentials, Status: http.StatusUnauthorized, Scheme: "bearer"},
+		},
+	}, time.Now())
+	assert.Equal(t, []string{
+		fmt.Sprintf("REGISTRY_EXAMPLE_COM_AUTH_FILE cannot be used: open %s: no such file or directory", filepath.Join(dir, "missing")),
+		"set both REGISTRY_EXAMPLE_COM_USER and REGISTRY_EXAMPLE_COM_PASSWORD",
+		"registry.example.com rejected the credentials from REGISTRY_EXAMPLE_COM_TOKEN_FILE, check that they are valid",
+	}, suggestions)
+}
+
+func TestDiagnose(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	expired := unsignedJWT(`{"exp":1700000000,"access":[{"type":"repository","name":"hsn723/fuga","actions":["pull"]}]}`)
+	cases := []struct {
+		title       string
+		registry    mockRegistry
+		imagePath   string
+		tag         string
+		token       string
+		expect      []AuthAttempt
+		suggestions func(url, name string) []string
+	}{
+		{
+			title: "NoCredentials",
+			registry: mockRegistry{
+				bearer: "aG9nZWJlYXJlcg==",
+				tags:   []string{"1.0.0"},
+			},
+			imagePath: "hsn723/hoge",
+			tag:       "1.0.0",
+			expect: []AuthAttempt{
+				{Method: authMethodAnonymous, Status: http.StatusForbidden},
+				{Method: authMethodAnonymousToken, Error: "registry did not send an authentication challenge: 200"},
+				{Method: authMethodCredentials},
+			},
+			suggestions: func(_, name string) []string {
+				return []string{fmt.Sprintf("no credentials were found, set %s_USER and %s_PASSWORD, or %s_TOKEN, or run the registry-name command for all variables", name, name, name)}
+			},
+		},
+		{
+			title: "ExpiredToken",
+			registry: mockRegistry{
+				bearer: expired,
+				tags:   []string{"1.0.0"},
+			},
+			imagePath: "hsn723/hoge",
+			tag:       "1.0.0",
+			token:     expired,
+			expect: []AuthAttempt{
+				{Method: authMethodAnonymous, Status: http.StatusForbidden},
+				{Method: authMethodAnonymousToken, Error: "registry did not send an authentication challenge: 200"},
+				{
+					Method: authMethodCredentials,
+					OK:     true,
+					Status: http.StatusOK,
+					Scheme: "bearer",
+					Claims: &TokenClaims{
+						Expiry: timeRef(time.Unix(1700000000, 0).UTC()),
+						Access: []string{"repository:hsn723/fuga:pull"},
+					},
+				},
+			},
+			suggestions: func(_, name string) []string {
+				return []string{fmt.Sprintf("the token from %s_TOKEN expired at 2023-11-14T22:13:20Z, renew it", name)}
+			},
+		},
+		{
+			title: "PublicMissingTag",
+			registry: mockRegistry{
+				scope:     "repository:hsn723/public-hoge:pull",
+				bearer:    "aG9nZWJlYXJlcg==",
+				anonymous: true,
+			},
+			imagePath: "hsn723/public-hoge",
+			tag:       "1.0.0",
+			expect: []AuthAttempt{
+				{Method: authMethodAnonymous, OK: true, Status: http.StatusNotFound},
+				{Method: authMethodAnonymousToken, OK: true, Status: http.StatusNotFound, Scheme: "bearer"},
+				{Method: authMethodCredentials},
+			},
+			suggestions: func(_, _ string) []string {
+				return []string{
+					"hsn723/public-hoge is public, credentials are not needed",
+					"access to hsn723/public-hoge works but the tag 1.0.0 does not exist",
+				}
+			},
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			registry := c.registry
+			registry.t = t
+			registry.init()
+			url := registry.server.Listener.Addr().String()
+			client := RegistryClient{
+				RegistryName: NormalizeRegistryName(url),
+				RegistryURL:  url,
+				ImagePath:    c.imagePath,
+				HttpClient:   http.DefaultClient,
+				Mirrors:      []string{"mirror.invalid"},
+			}
+			if c.token != "" {
+				t.Setenv(fmt.Sprintf("%s_TOKEN", client.RegistryName), c.token)
+			}
+			d := client.Diagnose(c.tag)
+			assert.Equal(t, url, d.Registry)
+			assert.Equal(t, client.RegistryName, d.RegistryName)
+			assert.Equal(t, client.RegistryName, d.NormalizedName)
+			assert.Equal(t, c.tag, d.Tag)
+			// Errors of the credentials attempt depend on the sources.
+			for i := range d.Attempts {
+				if d.Attempts[i].Method == authMethodCredentials && c.expect[i].Error == "" {
+					d.Attempts[i].Error = ""
+				}
+			}
+			assert.Equal(t, c.expect, d.Attempts)
+			assert.Equal(t, c.suggestions(url, client.RegistryName), d.Suggestions)
+		})
+	}
+}
+
+func TestSuggestLegacyName(t *testing.T) {
+	t.Setenv("MY_REGISTRY_IO_TOKEN", "hoge")
+	client := RegistryClient{
+		RegistryName: NormalizeRegistryName("my-registry.io"),
+		RegistryURL:  "my-registry.io",
+		ImagePath:    "hsn723/hoge",
+	}
+	suggestions := client.suggest(Diagnosis{
+		Sources: client.CredentialSources(),
+		Attempts: []AuthAttempt{
+			{Method: authMethodAnonymous, Status: http.StatusUnauthorized},
+			{Method: authMethodAnonymousToken, Status: http.StatusUnauthorized},
+			{Method: authMethodCredentials, Status: http.StatusUnauthorized},
+		},
+	}, time.Now())
+	assert.Contains(t, suggestions, "MY_REGISTRY_IO_TOKEN uses the legacy name MY_REGISTRY_IO and is ignored, as it may belong to another registry, rename it to MY__REGISTRY_IO_TOKEN if it is meant for my-registry.io")
+}
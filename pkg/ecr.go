@@ -0,0 +1,97 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ecrHostPattern = regexp.MustCompile(`^\d{12}\.dkr\.ecr(-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+	ecrAPI         = "https://api.ecr.%s.amazonaws.com%s/"
+)
+
+const (
+	ecrTarget = "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken"
+)
+
+type ecrAuthorizationResponse struct {
+	AuthorizationData []struct {
+		AuthorizationToken string `json:"authorizationToken"`
+	} `json:"authorizationData"`
+}
+
+// ecrProvider obtains credentials for Amazon ECR registries by calling
+// GetAuthorizationToken with the standard AWS credentials.
+type ecrProvider struct{}
+
+func (ecrProvider) match(registryURL string) bool {
+	return ecrHostPattern.MatchString(registryURL)
+}
+
+// endpoint returns the ECR API endpoint for the registry's region, which can
+// be overridden with AWS_ENDPOINT_URL_ECR or AWS_ENDPOINT_URL.
+func (ecrProvider) endpoint(registryURL string) (string, string) {
+	m := ecrHostPattern.FindStringSubmatch(registryURL)
+	region := m[2]
+	for _, env := range []string{"AWS_ENDPOINT_URL_ECR", "AWS_ENDPOINT_URL"} {
+		if endpoint := os.Getenv(env); endpoint != "" {
+			return region, endpoint
+		}
+	}
+	return region, fmt.Sprintf(ecrAPI, region, m[3])
+}
+
+func (ecrProvider) envNames() []string {
+	return []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_SHARED_CREDENTIALS_FILE"}
+}
+
+func (p ecrProvider) credentials(r RegistryClient) (Credentials, error) {
+	authToken, err := p.authToken(r)
+	return Credentials{AuthToken: authToken}, err
+}
+
+func (p ecrProvider) authToken(r RegistryClient) (string, error) {
+	creds, err := loadAWSCredentials()
+	if err != nil {
+		return "", fmt.Errorf("could not get AWS credentials for %s: %w", r.RegistryURL, err)
+	}
+	region, endpoint := p.endpoint(r.RegistryURL)
+	body := []byte("{}")
+	headers, err := signV4(http.MethodPost, endpoint, map[string]string{
+		"Content-Type": "application/x-amz-json-1.1",
+		"X-Amz-Target": ecrTarget,
+	}, body, creds, region, "ecr", time.Now())
+	if err != nil {
+		return "", err
+	}
+	status, _, res, err := r.retrieveWithBody(http.MethodPost, endpoint, headers, body)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("unexpected response from ECR GetAuthorizationToken: %d", status)
+	}
+	var auth ecrAuthorizationResponse
+	if err := json.Unmarshal(res, &auth); err != nil {
+		return "", err
+	}
+	if len(auth.AuthorizationData) == 0 {
+		return "", fmt.Errorf("no authorization data returned by ECR")
+	}
+	token := auth.AuthorizationData[0].AuthorizationToken
+	decoded, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return "", err
+	}
+	user, _, ok := strings.Cut(string(decoded), ":")
+	if !ok || user != "AWS" {
+		return "", fmt.Errorf("unexpected ECR authorization token format")
+	}
+	return token, nil
+}
@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestECRProviderMatch(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title    string
+		registry string
+		expect   bool
+	}{
+		{
+			title:    "ECR",
+			registry: "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+			expect:   true,
+		},
+		{
+			title:    "ECRFIPS",
+			registry: "123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com",
+			expect:   true,
+		},
+		{
+			title:    "ECRChina",
+			registry: "123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn",
+			expect:   true,
+		},
+		{
+			title:    "ECRPublic",
+			registry: "public.ecr.aws",
+		},
+		{
+			title:    "GHCR",
+			registry: "ghcr.io",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, c.expect, ecrProvider{}.match(c.registry))
+		})
+	}
+}
+
+func TestECRProviderAuthToken(t *testing.T) {
+	cases := []struct {
+		title    string
+		status   int
+		response string
+		expect   string
+		isErr    bool
+	}{
+		{
+			title:    "Success",
+			status:   http.StatusOK,
+			response: `{"authorizationData":[{"authorizationToken":"QVdTOmhvZ2U=","expiresAt":1700000000,"proxyEndpoint":"https://123456789012.dkr.ecr.us-east-1.amazonaws.com"}]}`,
+			expect:   "QVdTOmhvZ2U=",
+		},
+		{
+			title:    "UnexpectedUser",
+			status:   http.StatusOK,
+			response: `{"authorizationData":[{"authorizationToken":"aG9nZTpoaWdl"}]}`,
+			isErr:    true,
+		},
+		{
+			title:    "NoAuthorizationData",
+			status:   http.StatusOK,
+			response: `{"authorizationData":[]}`,
+			isErr:    true,
+		},
+		{
+			title:  "Denied",
+			status: http.StatusBadRequest,
+			isErr:  true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			t.Helper()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.Header.Get("X-Amz-Target") != ecrTarget ||
+					!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") ||
+					!strings.Contains(r.Header.Get("Authorization"), "/us-east-1/ecr/aws4_request") {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.WriteHeader(c.status)
+				_, _ = w.Write([]byte(c.response))
+			}))
+			defer server.Close()
+			t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+			t.Setenv("AWS_ENDPOINT_URL_ECR", server.URL)
+			client := RegistryClient{
+				RegistryURL: "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+				HttpClient:  http.DefaultClient,
+			}
+			actual, err := ecrProvider{}.authToken(client)
+			assertExpectedErr(t, err, c.isErr)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
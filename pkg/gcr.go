@@ -0,0 +1,236 @@
+package pkg
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	gcpMetadataTokenAPI = "http://%s/computeMetadata/v1/instance/service-accounts/default/token"
+
+	// gcpMetadataClient talks to the GCE metadata server, which is local to
+	// the host: it bypasses proxies and gives up quickly off Google Cloud,
+	// as Google's client libraries do.
+	gcpMetadataClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy: nil,
+			DialContext: (&net.Dialer{
+				Timeout:   2 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			IdleConnTimeout: 60 * time.Second,
+		},
+		Timeout: 5 * time.Second,
+	}
+)
+
+const (
+	gcpMetadataHost   = "metadata.google.internal"
+	gcpTokenURI       = "https://oauth2.googleapis.com/token"
+	gcpScope          = "https://www.googleapis.com/auth/cloud-platform"
+	gcpJWTBearerGrant = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	gcpRegistryUser   = "oauth2accesstoken"
+)
+
+// gcpServiceAccount is the subset of a service account key file needed to
+// request access tokens.
+type gcpServiceAccount struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// gcrProvider obtains credentials for Google Artifact Registry and Container
+// Registry from a service account key or the GCE metadata server.
+type gcrProvider struct{}
+
+func (gcrProvider) match(registryURL string) bool {
+	return registryURL == "gcr.io" || strings.HasSuffix(registryURL, ".gcr.io") || strings.HasSuffix(registryURL, "-docker.pkg.dev")
+}
+
+func (gcrProvider) envNames() []string {
+	return []string{"GOOGLE_APPLICATION_CREDENTIALS", "GCE_METADATA_HOST"}
+}
+
+func (p gcrProvider) credentials(r RegistryClient) (Credentials, error) {
+	authToken, err := p.authToken(r)
+	return Credentials{AuthToken: authToken}, err
+}
+
+func (p gcrProvider) authToken(r RegistryClient) (string, error) {
+	var accessToken string
+	var err error
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		accessToken, err = p.serviceAccountToken(r, path)
+	} else {
+		accessToken, err = p.metadataToken(r)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not get a Google access token for %s: %w", r.RegistryURL, err)
+	}
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", gcpRegistryUser, accessToken))), nil
+}
+
+func parseRSAPrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// signJWT returns a JWT for the given claims, signed with RS256.
+func signJWT(key *rsa.PrivateKey, keyID string, claims map[string]interface{}) (string, error) {
+	header := map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+	}
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := fmt.Sprintf("%s.%s", base64.RawURLEncoding.EncodeToString(h), base64.RawURLEncoding.EncodeToString(c))
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s.%s", unsigned, base64.RawURLEncoding.EncodeToString(sig)), nil
+}
+
+// serviceAccountToken exchanges a JWT signed with the service account key for
+// an access token at the key's token_uri.
+func (gcrProvider) serviceAccountToken(r RegistryClient, path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var sa gcpServiceAccount
+	if err := json.Unmarshal(b, &sa); err != nil {
+		return "", err
+	}
+	if sa.Type != "service_account" {
+		return "", fmt.Errorf("unsupported credentials type %q in %s", sa.Type, path)
+	}
+	key, err := parseRSAPrivateKey(sa.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	tokenURI := sa.TokenURI
+	if tokenURI == "" {
+		tokenURI = gcpTokenURI
+	}
+	now := time.Now()
+	assertion, err := signJWT(key, sa.PrivateKeyID, map[string]interface{}{
+		"iss":   sa.ClientEmail,
+		"scope": gcpScope,
+		"aud":   tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {gcpJWTBearerGrant},
+		"assertion":  {assertion},
+	}
+	headers := map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded",
+	}
+	status, _, res, err := r.retrieveWithBody(http.MethodPost, tokenURI, headers, []byte(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	return parseAccessToken(status, res)
+}
+
+// metadataToken requests an access token for the default service account
+// from the GCE metadata server, whose host can be overridden with
+// GCE_METADATA_HOST. The request does not go through the registry's HTTP
+// client, so that it is never sent to a proxy. Failing to reach the default
+// metadata server means the host is not running on Google Cloud, and is
+// reported as ErrCredentialsNotFound.
+func (gcrProvider) metadataToken(r RegistryClient) (string, error) {
+	host := os.Getenv("GCE_METADATA_HOST")
+	explicit := host != ""
+	if !explicit {
+		host = gcpMetadataHost
+	}
+	status, res, err := getMetadata(r.context(), fmt.Sprintf(gcpMetadataTokenAPI, host))
+	if err != nil {
+		if !explicit && r.context().Err() == nil {
+			return "", fmt.Errorf("%w: GOOGLE_APPLICATION_CREDENTIALS is unset and the GCE metadata server cannot be reached: %v", ErrCredentialsNotFound, err)
+		}
+		return "", err
+	}
+	return parseAccessToken(status, res)
+}
+
+// getMetadata requests an endpoint of the GCE metadata server.
+func getMetadata(ctx context.Context, endpoint string) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return -1, nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	res, err := gcpMetadataClient.Do(req)
+	if err != nil {
+		return -1, nil, err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return -1, nil, err
+	}
+	return res.StatusCode, b, nil
+}
+
+func parseAccessToken(status int, res []byte) (string, error) {
+	if status != http.StatusOK {
+		return "", fmt.Errorf("unexpected response code %d", status)
+	}
+	var token tokenResponse
+	if err := json.Unmarshal(res, &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("empty access token")
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,226 @@
+package pkg
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGCRProviderMatch(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title    string
+		registry string
+		expect   bool
+	}{
+		{
+			title:    "GCR",
+			registry: "gcr.io",
+			expect:   true,
+		},
+		{
+			title:    "RegionalGCR",
+			registry: "asia.gcr.io",
+			expect:   true,
+		},
+		{
+			title:    "ArtifactRegistry",
+			registry: "asia-northeast1-docker.pkg.dev",
+			expect:   true,
+		},
+		{
+			title:    "GHCR",
+			registry: "ghcr.io",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, c.expect, gcrProvider{}.match(c.registry))
+		})
+	}
+}
+
+// verifyJWT checks the signature of an RS256 JWT and returns its claims.
+func verifyJWT(t *testing.T, key *rsa.PublicKey, jwt string) map[string]interface{} {
+	t.Helper()
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
+func TestGCRProviderServiceAccount(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		claims := verifyJWT(t, &key.PublicKey, r.PostForm.Get("assertion"))
+		if r.PostForm.Get("grant_type") != gcpJWTBearerGrant || claims == nil || claims["iss"] != "hoge@hoge.iam.gserviceaccount.com" || claims["scope"] != gcpScope {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"ya29.hoge","expires_in":3599,"token_type":"Bearer"}`))
+	}))
+	defer server.Close()
+	sa, err := json.Marshal(gcpServiceAccount{
+		Type:         "service_account",
+		ClientEmail:  "hoge@hoge.iam.gserviceaccount.com",
+		PrivateKeyID: "hogekey",
+		PrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenURI:     server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "sa.json")
+	if err := os.WriteFile(path, sa, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+	client := RegistryClient{
+		RegistryURL: "gcr.io",
+		HttpClient:  http.DefaultClient,
+	}
+	actual, err := gcrProvider{}.authToken(client)
+	assert.NoError(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("oauth2accesstoken:ya29.hoge")), actual)
+}
+
+func TestGCRProviderMetadata(t *testing.T) {
+	cases := []struct {
+		title    string
+		response string
+		expect   string
+		isErr    bool
+	}{
+		{
+			title:    "Success",
+			response: `{"access_token":"ya29.hige","expires_in":3599,"token_type":"Bearer"}`,
+			expect:   base64.StdEncoding.EncodeToString([]byte("oauth2accesstoken:ya29.hige")),
+		},
+		{
+			title:    "EmptyToken",
+			response: `{}`,
+			isErr:    true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			t.Helper()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/token" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				_, _ = w.Write([]byte(c.response))
+			}))
+			defer server.Close()
+			t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+			t.Setenv("GCE_METADATA_HOST", server.Listener.Addr().String())
+			client := RegistryClient{
+				RegistryURL: "asia-northeast1-docker.pkg.dev",
+				HttpClient:  http.DefaultClient,
+			}
+			actual, err := gcrProvider{}.authToken(client)
+			assertExpectedErr(t, err, c.isErr)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
+
+func TestGCRMetadataTokenBypassesRegistryClient(t *testing.T) {
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"access_token":"ya29.hige","expires_in":3599,"token_type":"Bearer"}`))
+	}))
+	defer metadata.Close()
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+	t.Setenv("GCE_METADATA_HOST", metadata.Listener.Addr().String())
+	client := RegistryClient{
+		RegistryURL: "asia-northeast1-docker.pkg.dev",
+		// The registry's client, as behind an unreachable proxy.
+		HttpClient: &http.Client{Transport: offlineTransport{}},
+	}
+	actual, err := gcrProvider{}.metadataToken(client)
+	assert.NoError(t, err)
+	assert.Equal(t, "ya29.hige", actual)
+}
+
+func TestGCRProviderCheckTag(t *testing.T) {
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"access_token":"ya29.hige","expires_in":3599,"token_type":"Bearer"}`))
+	}))
+	defer metadata.Close()
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+	t.Setenv("GCE_METADATA_HOST", metadata.Listener.Addr().String())
+	registry := mockRegistry{
+		t:              t,
+		scope:          "repository:hsn723/hoge:pull",
+		basic:          base64.StdEncoding.EncodeToString([]byte("oauth2accesstoken:ya29.hige")),
+		bearer:         "aG9nZWJlYXJlcg==",
+		tags:           []string{"1.0.0"},
+		realm:          "/v2/token",
+		oauth2Disabled: true,
+	}
+	registry.init()
+	// Route requests for the registry host to the mock registry.
+	dialer := &net.Dialer{}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if strings.HasSuffix(addr, "-docker.pkg.dev:80") {
+				addr = registry.server.Listener.Addr().String()
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+	client := RegistryClient{
+		RegistryName: NormalizeRegistryName("asia-northeast1-docker.pkg.dev"),
+		RegistryURL:  "asia-northeast1-docker.pkg.dev",
+		ImagePath:    "hsn723/hoge",
+		HttpClient:   &http.Client{Transport: mockTransport{Transport: transport}},
+	}
+	actual, err := client.CheckTag("1.0.0")
+	assert.NoError(t, err)
+	assert.True(t, actual.Found)
+}
@@ -0,0 +1,137 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// identityTokenUser is the username docker credential helpers return
+	// along with an identity token, that is a refresh token, as secret.
+	identityTokenUser = "<token>"
+	// ghcrUser is sent along with GITHUB_TOKEN, as ghcr.io accepts any
+	// username with a token.
+	ghcrUser = "x-access-token"
+)
+
+// ErrCredentialsNotFound is returned when there are no credentials for the
+// registry, or none in a form usable by docker credential helpers.
+var ErrCredentialsNotFound = errors.New("credentials not found")
+
+// Authorization is the value of an Authorization header for a registry.
+type Authorization struct {
+	// Scheme is Bearer, or Basic for registries using basic authentication.
+	Scheme string
+	Token  string
+	// Anonymous is true if the token was obtained without credentials.
+	Anonymous bool
+}
+
+// String returns the header value.
+func (a Authorization) String() string {
+	return fmt.Sprintf("%s %s", a.Scheme, a.Token)
+}
+
+// PullAuthorization returns an Authorization header value granting pull
+// access to the repository, obtained with credentials as for tag lookups, or
+// with an anonymous token if there are none. Credentials that cannot be used,
+// for instance because the registry rejects them, are reported as errors
+// rather than falling back to an anonymous token. Mirrors are not consulted.
+func (r RegistryClient) PullAuthorization() (Authorization, error) {
+	r = r.withChallengeCache()
+	token, err := r.getBearerToken()
+	if err == nil {
+		scheme, credentials, _ := strings.Cut(authorizationHeader(token), " ")
+		return Authorization{Scheme: scheme, Token: credentials}, nil
+	}
+	if !errors.Is(err, ErrCredentialsNotFound) {
+		return Authorization{}, err
+	}
+	anonToken, anonErr := r.getAnonymousToken()
+	if anonErr != nil {
+		return Authorization{}, fmt.Errorf("%w (anonymous token: %v)", err, anonErr)
+	}
+	return Authorization{Scheme: "Bearer", Token: anonToken, Anonymous: true}, nil
+}
+
+// RegistryURLFromServerURL returns the registry, as used in image names, for
+// the server URL passed to docker credential helpers, which may include a
+// scheme and a path. Docker Hub is passed as its legacy index URL.
+func RegistryURLFromServerURL(serverURL string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(serverURL), "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	switch host {
+	case "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+	return host
+}
+
+// splitAuthToken decodes a basic auth token into the username and password.
+func splitAuthToken(authToken string) (string, string, bool) {
+	creds, err := base64.StdEncoding.DecodeString(authToken)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(creds), ":")
+}
+
+// HelperCredentials returns the username and secret a docker credential
+// helper returns for the registry: a username and password, or the
+// "<token>" username along with a refresh token. Sources are consulted in
+// the same order as for tag lookups, except for bearer tokens, which docker
+// cannot use, and the docker configuration, which docker reads itself.
+func (r RegistryClient) HelperCredentials() (string, string, error) {
+	if err := r.checkCredentialFiles(); err != nil {
+		return "", "", err
+	}
+	if token := r.getenv("REFRESH_TOKEN"); token != "" {
+		return identityTokenUser, token, nil
+	}
+	if auth, ok := r.pullSecretAuth(); ok && auth.IdentityToken != "" {
+		return identityTokenUser, auth.IdentityToken, nil
+	}
+	authToken := r.getenv("AUTH")
+	if authToken == "" {
+		authToken, _ = r.getAuthTokenFromCredentials()
+	}
+	if authToken != "" {
+		user, pass, ok := splitAuthToken(authToken)
+		if !ok {
+			return "", "", fmt.Errorf("malformed basic auth credentials for %s", r.RegistryName)
+		}
+		return user, pass, nil
+	}
+	creds, err := r.adapter().Credentials(r)
+	if err != nil {
+		return "", "", err
+	}
+	switch {
+	case creds.RefreshToken != "":
+		return identityTokenUser, creds.RefreshToken, nil
+	case creds.AuthToken != "":
+		if user, pass, ok := splitAuthToken(creds.AuthToken); ok {
+			return user, pass, nil
+		}
+	}
+	for _, ci := range ciPlatforms {
+		if !ci.match(r) {
+			continue
+		}
+		password := firstEnv(ci.password)
+		if password == "" {
+			continue
+		}
+		user := firstEnv(ci.user)
+		if user == "" {
+			user = ci.defaultUser
+		}
+		if user == "" && ci.bearer {
+			user = ghcrUser
+		}
+		return user, password, nil
+	}
+	return "", "", fmt.Errorf("%w for %s", ErrCredentialsNotFound, r.RegistryName)
+}
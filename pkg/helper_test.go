@@ -0,0 +1,302 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// offlineTransport fails every request, as when the metadata servers of
+// cloud providers cannot be reached.
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("network is unreachable")
+}
+
+// unsetCloudCredentials clears the environment consulted by cloud provider
+// adapters and makes the GCE metadata server unreachable, so that they find
+// no credentials.
+func unsetCloudCredentials(t *testing.T) {
+	t.Helper()
+	metadataClient := gcpMetadataClient
+	gcpMetadataClient = &http.Client{Transport: offlineTransport{}}
+	t.Cleanup(func() { gcpMetadataClient = metadataClient })
+	for _, k := range []string{
+		"GOOGLE_APPLICATION_CREDENTIALS", "GCE_METADATA_HOST",
+		"AZURE_TENANT_ID", "AZURE_CLIENT_ID", "AZURE_CLIENT_SECRET",
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SHARED_CREDENTIALS_FILE", "AWS_PROFILE",
+	} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("HOME", t.TempDir())
+}
+
+func TestPullAuthorization(t *testing.T) {
+	publicImage := mockRegistry{
+		scope:     "repository:hsn723/hoge:pull",
+		bearer:    "aG9nZWJlYXJlcg==",
+		anonymous: true,
+	}
+	anonymous := Authorization{Scheme: "Bearer", Token: "aG9nZWJlYXJlcg==", Anonymous: true}
+	cases := []struct {
+		title    string
+		registry mockRegistry
+		// registryURL is the host the mock registry is reached as, if not
+		// its own address. Other hosts cannot be reached.
+		registryURL string
+		env         map[string]string
+		expect      Authorization
+		isErr       bool
+	}{
+		{
+			title: "Anonymous",
+			registry: mockRegistry{
+				scope:     "repository:hsn723/hoge:pull",
+				bearer:    "aG9nZWJlYXJlcg==",
+				anonymous: true,
+			},
+			expect: Authorization{Scheme: "Bearer", Token: "aG9nZWJlYXJlcg==", Anonymous: true},
+		},
+		{
+			title: "Credentials",
+			registry: mockRegistry{
+				scope:  "repository:hsn723/hoge:pull",
+				basic:  "aG9nZTpmdWdh",
+				bearer: "aG9nZWJlYXJlcg==",
+			},
+			env:    map[string]string{"USER": "hoge", "PASSWORD": "fuga"},
+			expect: Authorization{Scheme: "Bearer", Token: "aG9nZWJlYXJlcg=="},
+		},
+		{
+			title: "BasicOnly",
+			registry: mockRegistry{
+				basic:     "aG9nZTpmdWdh",
+				basicOnly: true,
+			},
+			env:    map[string]string{"AUTH": "aG9nZTpmdWdh"},
+			expect: Authorization{Scheme: "Basic", Token: "aG9nZTpmdWdh"},
+		},
+		{
+			title: "RejectedCredentials",
+			registry: mockRegistry{
+				scope:     "repository:hsn723/hoge:pull",
+				basic:     "aG9nZTpmdWdh",
+				bearer:    "aG9nZWJlYXJlcg==",
+				anonymous: true,
+			},
+			env:   map[string]string{"USER": "hoge", "PASSWORD": "piyo"},
+			isErr: true,
+		},
+		{
+			title:    "NoCredentials",
+			registry: mockRegistry{},
+			isErr:    true,
+		},
+		{
+			title:       "GCRPublic",
+			registry:    publicImage,
+			registryURL: "gcr.io",
+			expect:      anonymous,
+		},
+		{
+			title:       "ArtifactRegistryPublic",
+			registry:    publicImage,
+			registryURL: "asia-northeast1-docker.pkg.dev",
+			expect:      anonymous,
+		},
+		{
+			title:       "ACRPublic",
+			registry:    publicImage,
+			registryURL: "hoge.azurecr.io",
+			expect:      anonymous,
+		},
+		{
+			title:       "ECRPublic",
+			registry:    publicImage,
+			registryURL: "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+			expect:      anonymous,
+		},
+		{
+			title:       "ECRPublicGallery",
+			registry:    publicImage,
+			registryURL: "public.ecr.aws",
+			expect:      anonymous,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			unsetCloudCredentials(t)
+			registry := c.registry
+			registry.t = t
+			registry.init()
+			url := registry.server.Listener.Addr().String()
+			httpClient := http.DefaultClient
+			if c.registryURL != "" {
+				mockAddr := url
+				url = c.registryURL
+				dialer := &net.Dialer{}
+				httpClient = &http.Client{Transport: mockTransport{Transport: &http.Transport{
+					DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+						if addr != c.registryURL+":80" {
+							return nil, errors.New("network is unreachable")
+						}
+						return dialer.DialContext(ctx, network, mockAddr)
+					},
+				}}}
+			}
+			client := RegistryClient{
+				RegistryName: NormalizeRegistryName(url),
+				RegistryURL:  url,
+				ImagePath:    "hsn723/hoge",
+				HttpClient:   httpClient,
+			}
+			for k, v := range c.env {
+				t.Setenv(fmt.Sprintf("%s_%s", client.RegistryName, k), v)
+			}
+			actual, err := client.PullAuthorization()
+			assertExpectedErr(t, err, c.isErr)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
+
+func TestHelperCredentials(t *testing.T) {
+	cases := []struct {
+		title      string
+		client     RegistryClient
+		env        map[string]string
+		expectUser string
+		expectPass string
+		isErr      bool
+		notFound   bool
+	}{
+		{
+			title:      "RefreshToken",
+			client:     RegistryClient{RegistryName: "HELPER_EXAMPLE_COM", RegistryURL: "helper.example.com"},
+			env:        map[string]string{"HELPER_EXAMPLE_COM_REFRESH_TOKEN": "hogerefresh", "HELPER_EXAMPLE_COM_AUTH": "aG9nZTpmdWdh"},
+			expectUser: "<token>",
+			expectPass: "hogerefresh",
+		},
+		{
+			title:      "Auth",
+			client:     RegistryClient{RegistryName: "HELPER_EXAMPLE_COM", RegistryURL: "helper.example.com"},
+			env:        map[string]string{"HELPER_EXAMPLE_COM_AUTH": "aG9nZTpmdWdh"},
+			expectUser: "hoge",
+			expectPass: "fuga",
+		},
+		{
+			title:      "UserPassword",
+			client:     RegistryClient{RegistryName: "HELPER_EXAMPLE_COM", RegistryURL: "helper.example.com"},
+			env:        map[string]string{"HELPER_EXAMPLE_COM_USER": "hoge", "HELPER_EXAMPLE_COM_PASSWORD": "fuga:piyo"},
+			expectUser: "hoge",
+			expectPass: "fuga:piyo",
+		},
+		{
+			title:  "MalformedAuth",
+			client: RegistryClient{RegistryName: "HELPER_EXAMPLE_COM", RegistryURL: "helper.example.com"},
+			env:    map[string]string{"HELPER_EXAMPLE_COM_AUTH": "hoge"},
+			isErr:  true,
+		},
+		{
+			title:    "BearerTokenOnly",
+			client:   RegistryClient{RegistryName: "HELPER_EXAMPLE_COM", RegistryURL: "helper.example.com"},
+			env:      map[string]string{"HELPER_EXAMPLE_COM_TOKEN": "hogebearer"},
+			isErr:    true,
+			notFound: true,
+		},
+		{
+			title:      "GitHubToken",
+			client:     RegistryClient{RegistryName: "GHCR_IO", RegistryURL: "ghcr.io"},
+			env:        map[string]string{"GITHUB_TOKEN": "hogetoken", "GITHUB_ACTOR": ""},
+			expectUser: "x-access-token",
+			expectPass: "hogetoken",
+		},
+		{
+			title:      "GitLab",
+			client:     RegistryClient{RegistryName: "REGISTRY_GITLAB_EXAMPLE_COM", RegistryURL: "registry.gitlab.example.com"},
+			env:        map[string]string{"GITLAB_CI": "true", "CI_REGISTRY": "registry.gitlab.example.com", "CI_REGISTRY_USER": "", "CI_REGISTRY_PASSWORD": "", "CI_JOB_TOKEN": "hogejob"},
+			expectUser: "gitlab-ci-token",
+			expectPass: "hogejob",
+		},
+		{
+			title:    "GCRNotConfigured",
+			client:   RegistryClient{RegistryName: "GCR_IO", RegistryURL: "gcr.io", HttpClient: &http.Client{Transport: offlineTransport{}}},
+			isErr:    true,
+			notFound: true,
+		},
+		{
+			title:    "ArtifactRegistryNotConfigured",
+			client:   RegistryClient{RegistryName: "ASIA_NORTHEAST1_DOCKER_PKG_DEV", RegistryURL: "asia-northeast1-docker.pkg.dev", HttpClient: &http.Client{Transport: offlineTransport{}}},
+			isErr:    true,
+			notFound: true,
+		},
+		{
+			title:    "ACRNotConfigured",
+			client:   RegistryClient{RegistryName: "HOGE_AZURECR_IO", RegistryURL: "hoge.azurecr.io", HttpClient: &http.Client{Transport: offlineTransport{}}},
+			isErr:    true,
+			notFound: true,
+		},
+		{
+			title:  "ACRPartialClientCredentials",
+			client: RegistryClient{RegistryName: "HOGE_AZURECR_IO", RegistryURL: "hoge.azurecr.io", HttpClient: &http.Client{Transport: offlineTransport{}}},
+			env:    map[string]string{"AZURE_TENANT_ID": "hoge-tenant"},
+			isErr:  true,
+		},
+		{
+			title:    "ECRNotConfigured",
+			client:   RegistryClient{RegistryName: "ECR_HOGE", RegistryURL: "123456789012.dkr.ecr.us-east-1.amazonaws.com", HttpClient: &http.Client{Transport: offlineTransport{}}},
+			isErr:    true,
+			notFound: true,
+		},
+		{
+			title:  "GCRMetadataHostUnreachable",
+			client: RegistryClient{RegistryName: "GCR_IO", RegistryURL: "gcr.io", HttpClient: &http.Client{Transport: offlineTransport{}}},
+			env:    map[string]string{"GCE_METADATA_HOST": "metadata.example.com"},
+			isErr:  true,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			unsetCloudCredentials(t)
+			for k, v := range c.env {
+				t.Setenv(k, v)
+			}
+			user, pass, err := c.client.HelperCredentials()
+			assertExpectedErr(t, err, c.isErr)
+			if c.notFound {
+				assert.ErrorIs(t, err, ErrCredentialsNotFound)
+			}
+			assert.Equal(t, c.expectUser, user)
+			assert.Equal(t, c.expectPass, pass)
+		})
+	}
+}
+
+func TestRegistryURLFromServerURL(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title     string
+		serverURL string
+		expect    string
+	}{
+		{title: "Host", serverURL: "ghcr.io", expect: "ghcr.io"},
+		{title: "URL", serverURL: "https://registry.example.com:5000/v2/\n", expect: "registry.example.com:5000"},
+		{title: "PlainHTTP", serverURL: "http://localhost:5000", expect: "localhost:5000"},
+		{title: "DockerHub", serverURL: "https://index.docker.io/v1/", expect: "docker.io"},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, c.expect, RegistryURLFromServerURL(c.serverURL))
+		})
+	}
+}
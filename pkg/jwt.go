@@ -0,0 +1,103 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TokenClaims holds the claims of a JWT bearer token relevant to registry
+// access. The signature is not verified.
+type TokenClaims struct {
+	Issuer   string     `json:"issuer,omitempty"`
+	Subject  string     `json:"subject,omitempty"`
+	Audience []string   `json:"audience,omitempty"`
+	IssuedAt *time.Time `json:"issuedAt,omitempty"`
+	Expiry   *time.Time `json:"expiry,omitempty"`
+	// Access lists the granted scopes in the format of the token
+	// authentication specification, such as repository:foo/bar:pull, from
+	// the access claim of registry tokens or the scope claim of OAuth2
+	// tokens.
+	Access []string `json:"access,omitempty"`
+}
+
+type jwtClaims struct {
+	Issuer   string          `json:"iss"`
+	Subject  string          `json:"sub"`
+	Audience json.RawMessage `json:"aud"`
+	IssuedAt json.Number     `json:"iat"`
+	Expiry   json.Number     `json:"exp"`
+	Access   []struct {
+		Type    string   `json:"type"`
+		Name    string   `json:"name"`
+		Actions []string `json:"actions"`
+	} `json:"access"`
+	Scope string `json:"scope"`
+}
+
+func unixClaim(n json.Number) *time.Time {
+	f, err := n.Float64()
+	if err != nil || f == 0 {
+		return nil
+	}
+	t := time.Unix(int64(f), 0).UTC()
+	return &t
+}
+
+// decodeTokenClaims decodes the claims of a JWT. Tokens that are not JWTs,
+// such as opaque tokens, result in an error.
+func decodeTokenClaims(token string) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWT payload: %w", err)
+	}
+	var c jwtClaims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, fmt.Errorf("malformed JWT claims: %w", err)
+	}
+	claims := &TokenClaims{
+		Issuer:   c.Issuer,
+		Subject:  c.Subject,
+		IssuedAt: unixClaim(c.IssuedAt),
+		Expiry:   unixClaim(c.Expiry),
+	}
+	// The audience is either a string or an array of strings.
+	var aud string
+	if err := json.Unmarshal(c.Audience, &aud); err == nil {
+		claims.Audience = []string{aud}
+	} else {
+		_ = json.Unmarshal(c.Audience, &claims.Audience)
+	}
+	for _, a := range c.Access {
+		claims.Access = append(claims.Access, fmt.Sprintf("%s:%s:%s", a.Type, a.Name, strings.Join(a.Actions, ",")))
+	}
+	claims.Access = append(claims.Access, strings.Fields(c.Scope)...)
+	return claims, nil
+}
+
+// grants returns true if the claims grant the action on the repository.
+func (c TokenClaims) grants(repository, action string) bool {
+	for _, scope := range c.Access {
+		parts := strings.Split(scope, ":")
+		if len(parts) < 3 || parts[0] != "repository" {
+			continue
+		}
+		// Repository names may contain a port, as in host:port/name.
+		name := strings.Join(parts[1:len(parts)-1], ":")
+		if name != repository && name != "*" {
+			continue
+		}
+		for _, a := range strings.Split(parts[len(parts)-1], ",") {
+			if a == action || a == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
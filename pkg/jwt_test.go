@@ -0,0 +1,118 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unsignedJWT returns a JWT with the given payload and a dummy signature.
+func unsignedJWT(payload string) string {
+	return "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".c2ln"
+}
+
+func timeRef(t time.Time) *time.Time {
+	return &t
+}
+
+func TestDecodeTokenClaims(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title  string
+		token  string
+		expect *TokenClaims
+		isErr  bool
+	}{
+		{
+			title: "RegistryToken",
+			token: unsignedJWT(`{"iss":"auth.example.com","sub":"hsn723","aud":"registry.example.com","iat":1700000000,"exp":1700000300,"access":[{"type":"repository","name":"hsn723/hoge","actions":["pull","push"]}]}`),
+			expect: &TokenClaims{
+				Issuer:   "auth.example.com",
+				Subject:  "hsn723",
+				Audience: []string{"registry.example.com"},
+				IssuedAt: timeRef(time.Unix(1700000000, 0).UTC()),
+				Expiry:   timeRef(time.Unix(1700000300, 0).UTC()),
+				Access:   []string{"repository:hsn723/hoge:pull,push"},
+			},
+		},
+		{
+			title: "OAuth2Scope",
+			token: unsignedJWT(`{"aud":["a","b"],"scope":"repository:hsn723/hoge:pull registry:catalog:*"}`),
+			expect: &TokenClaims{
+				Audience: []string{"a", "b"},
+				Access:   []string{"repository:hsn723/hoge:pull", "registry:catalog:*"},
+			},
+		},
+		{
+			title: "Opaque",
+			token: "aG9nZWJlYXJlcg==",
+			isErr: true,
+		},
+		{
+			title: "MalformedPayload",
+			token: "a.!!!.c",
+			isErr: true,
+		},
+		{
+			title: "MalformedClaims",
+			token: unsignedJWT(`[]`),
+			isErr: true,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			actual, err := decodeTokenClaims(c.token)
+			assertExpectedErr(t, err, c.isErr)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
+
+func TestTokenClaimsGrants(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title      string
+		access     []string
+		repository string
+		expect     bool
+	}{
+		{
+			title:      "Pull",
+			access:     []string{"repository:hsn723/hoge:pull"},
+			repository: "hsn723/hoge",
+			expect:     true,
+		},
+		{
+			title:      "PushOnly",
+			access:     []string{"repository:hsn723/hoge:push"},
+			repository: "hsn723/hoge",
+		},
+		{
+			title:      "OtherRepository",
+			access:     []string{"repository:hsn723/fuga:pull"},
+			repository: "hsn723/hoge",
+		},
+		{
+			title:      "Wildcard",
+			access:     []string{"repository:*:*"},
+			repository: "hsn723/hoge",
+			expect:     true,
+		},
+		{
+			title:      "Catalog",
+			access:     []string{"registry:catalog:*"},
+			repository: "hsn723/hoge",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, c.expect, TokenClaims{Access: c.access}.grants(c.repository, "pull"))
+		})
+	}
+}
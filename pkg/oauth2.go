@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	oauth2ClientID = "container-tag-exists"
+)
+
+func refreshTokenGrant(refreshToken string) url.Values {
+	return url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	}
+}
+
+func passwordGrant(user, pass string) url.Values {
+	return url.Values{
+		"grant_type": {"password"},
+		"username":   {user},
+		"password":   {pass},
+	}
+}
+
+// getRefreshToken returns a refresh token from ${REGISTRY_NAME}_REFRESH_TOKEN
+// or from the identity token stored in the pull secret or the docker
+// configuration.
+func (r RegistryClient) getRefreshToken() string {
+	if token := r.getenv("REFRESH_TOKEN"); token != "" {
+		return token
+	}
+	if auth, ok := r.pullSecretAuth(); ok && auth.IdentityToken != "" {
+		return auth.IdentityToken
+	}
+	config, err := loadDockerConfig()
+	if err != nil {
+		return ""
+	}
+	auth, ok := config.lookup(r.RegistryURL)
+	if !ok {
+		return ""
+	}
+	return auth.IdentityToken
+}
+
+// oauth2Endpoint returns the token endpoint and service for the OAuth2 flow,
+// preferring the configured endpoint, then the realm from the registry's
+// authentication challenge.
+func (r RegistryClient) oauth2Endpoint() (string, string) {
+	if r.TokenEndpoint != "" {
+		return r.TokenEndpoint, r.RegistryURL
+	}
+	if c, err := r.getChallenge(); err == nil && c.Realm != "" {
+		service := c.Service
+		if service == "" {
+			service = r.RegistryURL
+		}
+		return c.Realm, service
+	}
+	return fmt.Sprintf("%s/token", r.baseURL()), r.RegistryURL
+}
+
+// retrieveOAuth2Token requests a bearer token using the OAuth2 flow of the
+// token authentication specification, with the given grant.
+func (r RegistryClient) retrieveOAuth2Token(grant url.Values) (string, error) {
+	endpoint, service := r.oauth2Endpoint()
+	form := url.Values{
+		"service":   {service},
+		"scope":     {r.scope()},
+		"client_id": {oauth2ClientID},
+	}
+	for k, v := range grant {
+		form[k] = v
+	}
+	headers := map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded",
+	}
+	status, _, res, err := r.retrieveWithBody(http.MethodPost, endpoint, headers, []byte(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("unexpected response code %d", status)
+	}
+	var token tokenResponse
+	if err := json.Unmarshal(res, &token); err != nil {
+		return "", err
+	}
+	if token.bearer() == "" {
+		return "", fmt.Errorf("empty token in OAuth2 response")
+	}
+	r.cacheToken(r.credentialName(), token)
+	return token.bearer(), nil
+}
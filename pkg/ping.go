@@ -0,0 +1,280 @@
+package pkg
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"time"
+)
+
+var (
+	catalogAPI   = "%s/v2/_catalog?n=1"
+	referrersAPI = "%s/v2/%s/referrers/%s"
+	// emptyDigest is used to probe the referrers API when no manifest digest
+	// is known. Registries supporting the API answer with an empty index.
+	emptyDigest = "sha256:" + strings.Repeat("0", 64)
+)
+
+// FeatureStatus is the outcome of probing an optional registry feature.
+type FeatureStatus string
+
+const (
+	FeatureSupported   FeatureStatus = "supported"
+	FeatureUnsupported FeatureStatus = "unsupported"
+	// FeatureDenied means the registry refused access with the available
+	// credentials.
+	FeatureDenied FeatureStatus = "denied"
+	// FeatureUnknown means the response did not tell whether the feature is
+	// supported.
+	FeatureUnknown FeatureStatus = "unknown"
+	// FeatureSkipped means the feature was not probed, for instance for lack
+	// of a repository.
+	FeatureSkipped FeatureStatus = "skipped"
+	FeatureError   FeatureStatus = "error"
+
+	FeatureHEAD           = "head"
+	FeatureTagsPagination = "tags-pagination"
+	FeatureReferrers      = "referrers"
+	FeatureCatalog        = "catalog"
+)
+
+// FeatureProbe is the result of probing an optional registry feature.
+type FeatureProbe struct {
+	Feature string        `json:"feature"`
+	Status  FeatureStatus `json:"status"`
+	Detail  string        `json:"detail,omitempty"`
+}
+
+// CertificateInfo describes a certificate presented by the registry.
+type CertificateInfo struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	DNSNames  []string  `json:"dnsNames,omitempty"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+}
+
+// TLSInfo describes the TLS connection to the registry.
+type TLSInfo struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipherSuite"`
+	ServerName  string `json:"serverName"`
+	// ALPN is the protocol negotiated with ALPN, such as h2, if any.
+	ALPN string `json:"alpn,omitempty"`
+	// Certificates is the chain presented by the registry, leaf first.
+	Certificates []CertificateInfo `json:"certificates"`
+}
+
+// PingResult describes the answer of a registry to the API version check and
+// which optional features it supports.
+type PingResult struct {
+	Registry string `json:"registry"`
+	Endpoint string `json:"endpoint"`
+	// Reachable is true if the registry answered, whatever the status.
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+	Status    int    `json:"status,omitempty"`
+	// APIVersion is the Docker-Distribution-API-Version header.
+	APIVersion string `json:"apiVersion,omitempty"`
+	// TLS is set for registries served over HTTPS.
+	TLS *TLSInfo `json:"tls,omitempty"`
+	// Challenge is the authentication challenge sent by the registry, if any.
+	Challenge *Challenge     `json:"challenge,omitempty"`
+	Features  []FeatureProbe `json:"features,omitempty"`
+}
+
+func newTLSInfo(state tls.ConnectionState) *TLSInfo {
+	info := &TLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ServerName:  state.ServerName,
+		ALPN:        state.NegotiatedProtocol,
+	}
+	for _, cert := range state.PeerCertificates {
+		info.Certificates = append(info.Certificates, CertificateInfo{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			DNSNames:  cert.DNSNames,
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+		})
+	}
+	return info
+}
+
+// Ping calls the API version check endpoint of the registry, ignoring
+// mirrors, and reports whether it answered, the TLS connection, the API
+// version and the authentication challenge. If ImagePath is set, optional
+// features are then probed on that repository with the same authentication
+// as tag lookups: HEAD requests for manifests, tag list pagination and the
+// referrers API. Access to the catalog is probed in any case.
+func (r RegistryClient) Ping() PingResult {
+	res := PingResult{
+		Registry: r.RegistryURL,
+		Endpoint: fmt.Sprintf(pingAPI, r.baseURL()),
+	}
+	// The connection is captured rather than the handshake so that reused
+	// connections are reported as well.
+	var tlsState *tls.ConnectionState
+	ctx := httptrace.WithClientTrace(r.context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if conn, ok := info.Conn.(*tls.Conn); ok {
+				state := conn.ConnectionState()
+				tlsState = &state
+			}
+		},
+	})
+	status, header, err := r.withContext(ctx).ping()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Reachable = true
+	res.Status = status
+	res.APIVersion = header.Get("Docker-Distribution-API-Version")
+	if tlsState != nil {
+		res.TLS = newTLSInfo(*tlsState)
+	}
+	if h := header.Get("WWW-Authenticate"); h != "" {
+		if c, err := parseChallenge(h); err == nil {
+			res.Challenge = &c
+		}
+	}
+	res.Features = r.probeFeatures()
+	return res
+}
+
+func skippedProbe(feature, detail string) FeatureProbe {
+	return FeatureProbe{Feature: feature, Status: FeatureSkipped, Detail: detail}
+}
+
+// statusProbe reports unexpected statuses, and denied access for 401 and 403.
+func statusProbe(feature string, status int) FeatureProbe {
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		return FeatureProbe{Feature: feature, Status: FeatureDenied, Detail: fmt.Sprintf("status %d", status)}
+	}
+	return FeatureProbe{Feature: feature, Status: FeatureError, Detail: fmt.Sprintf("unexpected status %d", status)}
+}
+
+func (r RegistryClient) probeFeatures() []FeatureProbe {
+	if r.ImagePath == "" {
+		const detail = "no repository given"
+		return []FeatureProbe{
+			skippedProbe(FeatureHEAD, detail),
+			skippedProbe(FeatureTagsPagination, detail),
+			skippedProbe(FeatureReferrers, detail),
+			r.probeCatalog(""),
+		}
+	}
+	var tags []string
+	var next, bearer string
+	err := r.withAuth(func(b string) error {
+		var err error
+		tags, next, err = r.listTagsPage(b, fmt.Sprintf(tagsListAPI, r.baseURL(), r.ImagePath)+"?n=1")
+		bearer = b
+		return err
+	})
+	if err != nil {
+		const detail = "tags could not be listed"
+		return []FeatureProbe{
+			skippedProbe(FeatureHEAD, detail),
+			{Feature: FeatureTagsPagination, Status: FeatureError, Detail: err.Error()},
+			skippedProbe(FeatureReferrers, detail),
+			r.probeCatalog(""),
+		}
+	}
+	pagination := FeatureProbe{Feature: FeatureTagsPagination}
+	switch {
+	case len(tags) > 1:
+		pagination.Status = FeatureUnsupported
+		pagination.Detail = fmt.Sprintf("%d tags returned for n=1", len(tags))
+	case next != "":
+		pagination.Status = FeatureSupported
+		pagination.Detail = "Link header with rel=\"next\""
+	default:
+		pagination.Status = FeatureUnknown
+		pagination.Detail = "the repository has fewer than 2 tags"
+	}
+	head, digest := skippedProbe(FeatureHEAD, "the repository has no tags"), ""
+	if len(tags) > 0 {
+		head, digest = r.probeHEAD(bearer, tags[0])
+	}
+	return []FeatureProbe{head, pagination, r.probeReferrers(bearer, digest), r.probeCatalog(bearer)}
+}
+
+// probeHEAD sends a HEAD request for the manifest of the tag and returns the
+// manifest digest, if any.
+func (r RegistryClient) probeHEAD(bearer, tag string) (FeatureProbe, string) {
+	headers := map[string]string{
+		"Accept": strings.Join(manifestAcceptTypes, ", "),
+	}
+	if bearer != "" {
+		headers["Authorization"] = authorizationHeader(bearer)
+	}
+	status, header, _, err := r.retrieveWithHeader(http.MethodHead, fmt.Sprintf(manifestAPI, r.baseURL(), r.ImagePath, tag), headers)
+	if err != nil {
+		return FeatureProbe{Feature: FeatureHEAD, Status: FeatureError, Detail: err.Error()}, ""
+	}
+	switch status {
+	case http.StatusOK:
+		digest := header.Get("Docker-Content-Digest")
+		detail := fmt.Sprintf("%s:%s", r.ImagePath, tag)
+		if digest != "" {
+			detail = fmt.Sprintf("%s is %s", detail, digest)
+		}
+		return FeatureProbe{Feature: FeatureHEAD, Status: FeatureSupported, Detail: detail}, digest
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return FeatureProbe{Feature: FeatureHEAD, Status: FeatureUnsupported, Detail: fmt.Sprintf("status %d", status)}, ""
+	}
+	return statusProbe(FeatureHEAD, status), ""
+}
+
+// probeReferrers lists the referrers of the digest, or of a digest that does
+// not exist if none is given.
+func (r RegistryClient) probeReferrers(bearer, digest string) FeatureProbe {
+	if digest == "" {
+		digest = emptyDigest
+	}
+	headers := map[string]string{
+		"Accept": "application/vnd.oci.image.index.v1+json",
+	}
+	if bearer != "" {
+		headers["Authorization"] = authorizationHeader(bearer)
+	}
+	status, header, _, err := r.retrieveWithHeader(http.MethodGet, fmt.Sprintf(referrersAPI, r.baseURL(), r.ImagePath, digest), headers)
+	if err != nil {
+		return FeatureProbe{Feature: FeatureReferrers, Status: FeatureError, Detail: err.Error()}
+	}
+	switch status {
+	case http.StatusOK:
+		if strings.HasPrefix(header.Get("Content-Type"), "application/vnd.oci.image.index.v1+json") {
+			return FeatureProbe{Feature: FeatureReferrers, Status: FeatureSupported}
+		}
+		return FeatureProbe{Feature: FeatureReferrers, Status: FeatureUnknown, Detail: fmt.Sprintf("unexpected content type %q", header.Get("Content-Type"))}
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return FeatureProbe{Feature: FeatureReferrers, Status: FeatureUnsupported, Detail: fmt.Sprintf("status %d", status)}
+	}
+	return statusProbe(FeatureReferrers, status)
+}
+
+// probeCatalog lists the first repository of the catalog. Bearer tokens
+// scoped to a repository usually do not grant catalog access.
+func (r RegistryClient) probeCatalog(bearer string) FeatureProbe {
+	headers := map[string]string{}
+	if bearer != "" {
+		headers["Authorization"] = authorizationHeader(bearer)
+	}
+	status, _, err := r.retrieve(http.MethodGet, fmt.Sprintf(catalogAPI, r.baseURL()), headers)
+	if err != nil {
+		return FeatureProbe{Feature: FeatureCatalog, Status: FeatureError, Detail: err.Error()}
+	}
+	switch status {
+	case http.StatusOK:
+		return FeatureProbe{Feature: FeatureCatalog, Status: FeatureSupported}
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return FeatureProbe{Feature: FeatureCatalog, Status: FeatureUnsupported, Detail: fmt.Sprintf("status %d", status)}
+	}
+	return statusProbe(FeatureCatalog, status)
+}
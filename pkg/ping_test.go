@@ -0,0 +1,179 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPing(t *testing.T) {
+	t.Parallel()
+	manifest := []byte(`{"schemaVersion":2}`)
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(manifest))
+	cases := []struct {
+		title     string
+		registry  mockRegistry
+		imagePath string
+		expect    []FeatureProbe
+		challenge bool
+	}{
+		{
+			title: "Supported",
+			registry: mockRegistry{
+				scope:     "repository:hsn723/hoge:pull",
+				bearer:    "aG9nZWJlYXJlcg==",
+				tags:      []string{"1.0.0", "2.0.0"},
+				pageSize:  1,
+				manifest:  manifest,
+				referrers: true,
+				anonymous: true,
+			},
+			imagePath: "hsn723/hoge",
+			challenge: true,
+			expect: []FeatureProbe{
+				{Feature: FeatureHEAD, Status: FeatureSupported, Detail: fmt.Sprintf("hsn723/hoge:1.0.0 is %s", digest)},
+				{Feature: FeatureTagsPagination, Status: FeatureSupported, Detail: `Link header with rel="next"`},
+				{Feature: FeatureReferrers, Status: FeatureSupported},
+				{Feature: FeatureCatalog, Status: FeatureSupported},
+			},
+		},
+		{
+			title: "Unsupported",
+			registry: mockRegistry{
+				bearer: "aG9nZWJlYXJlcg==",
+				tags:   []string{"1.0.0", "2.0.0"},
+			},
+			imagePath: "hsn723/public-hoge",
+			expect: []FeatureProbe{
+				{Feature: FeatureHEAD, Status: FeatureSupported, Detail: "hsn723/public-hoge:1.0.0"},
+				{Feature: FeatureTagsPagination, Status: FeatureUnsupported, Detail: "2 tags returned for n=1"},
+				{Feature: FeatureReferrers, Status: FeatureUnsupported, Detail: "status 404"},
+				{Feature: FeatureCatalog, Status: FeatureDenied, Detail: "status 401"},
+			},
+		},
+		{
+			title: "SingleTag",
+			registry: mockRegistry{
+				bearer: "aG9nZWJlYXJlcg==",
+				tags:   []string{"1.0.0"},
+			},
+			imagePath: "hsn723/public-hoge",
+			expect: []FeatureProbe{
+				{Feature: FeatureHEAD, Status: FeatureSupported, Detail: "hsn723/public-hoge:1.0.0"},
+				{Feature: FeatureTagsPagination, Status: FeatureUnknown, Detail: "the repository has fewer than 2 tags"},
+				{Feature: FeatureReferrers, Status: FeatureUnsupported, Detail: "status 404"},
+				{Feature: FeatureCatalog, Status: FeatureDenied, Detail: "status 401"},
+			},
+		},
+		{
+			title: "NoRepository",
+			registry: mockRegistry{
+				bearer: "aG9nZWJlYXJlcg==",
+			},
+			expect: []FeatureProbe{
+				{Feature: FeatureHEAD, Status: FeatureSkipped, Detail: "no repository given"},
+				{Feature: FeatureTagsPagination, Status: FeatureSkipped, Detail: "no repository given"},
+				{Feature: FeatureReferrers, Status: FeatureSkipped, Detail: "no repository given"},
+				{Feature: FeatureCatalog, Status: FeatureDenied, Detail: "status 401"},
+			},
+		},
+		{
+			title: "TagsDenied",
+			registry: mockRegistry{
+				bearer: "aG9nZWJlYXJlcg==",
+				tags:   []string{"1.0.0"},
+			},
+			imagePath: "hsn723/hoge",
+			expect: []FeatureProbe{
+				{Feature: FeatureHEAD, Status: FeatureSkipped, Detail: "tags could not be listed"},
+				{Feature: FeatureTagsPagination, Status: FeatureError},
+				{Feature: FeatureReferrers, Status: FeatureSkipped, Detail: "tags could not be listed"},
+				{Feature: FeatureCatalog, Status: FeatureDenied, Detail: "status 401"},
+			},
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			registry := c.registry
+			registry.t = t
+			registry.init()
+			url := registry.server.Listener.Addr().String()
+			client := RegistryClient{
+				RegistryName: NormalizeRegistryName(url),
+				RegistryURL:  url,
+				ImagePath:    c.imagePath,
+				HttpClient:   http.DefaultClient,
+			}
+			res := client.Ping()
+			assert.True(t, res.Reachable)
+			assert.Empty(t, res.Error)
+			assert.Equal(t, fmt.Sprintf("https://%s/v2/", url), res.Endpoint)
+			if c.challenge {
+				assert.Equal(t, http.StatusUnauthorized, res.Status)
+				assert.Equal(t, &Challenge{Scheme: "bearer", Realm: fmt.Sprintf("https://%s/token", url), Service: url}, res.Challenge)
+			} else {
+				assert.Equal(t, http.StatusOK, res.Status)
+				assert.Nil(t, res.Challenge)
+			}
+			// Error details depend on the authentication attempts.
+			for i := range res.Features {
+				if res.Features[i].Status == FeatureError {
+					res.Features[i].Detail = ""
+				}
+			}
+			assert.Equal(t, c.expect, res.Features)
+		})
+	}
+}
+
+func TestPingTLS(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+	}))
+	t.Cleanup(server.Close)
+	url := server.Listener.Addr().String()
+	client := RegistryClient{
+		RegistryName: NormalizeRegistryName(url),
+		RegistryURL:  url,
+		HttpClient:   server.Client(),
+	}
+	res := client.Ping()
+	assert.True(t, res.Reachable)
+	assert.Equal(t, "registry/2.0", res.APIVersion)
+	if assert.NotNil(t, res.TLS) {
+		assert.Equal(t, "TLS 1.3", res.TLS.Version)
+		assert.NotEmpty(t, res.TLS.CipherSuite)
+		if assert.NotEmpty(t, res.TLS.Certificates) {
+			assert.Contains(t, res.TLS.Certificates[0].DNSNames, "example.com")
+		}
+	}
+	assert.Contains(t, res.Features, FeatureProbe{Feature: FeatureCatalog, Status: FeatureUnsupported, Detail: "status 404"})
+}
+
+func TestPingUnreachable(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.Listener.Addr().String()
+	server.Close()
+	client := RegistryClient{
+		RegistryName: NormalizeRegistryName(url),
+		RegistryURL:  url,
+		ImagePath:    "hsn723/hoge",
+		HttpClient:   http.DefaultClient,
+	}
+	res := client.Ping()
+	assert.False(t, res.Reachable)
+	assert.NotEmpty(t, res.Error)
+	assert.Empty(t, res.Features)
+}
@@ -0,0 +1,39 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	// DirectProxy disables proxies for a registry.
+	DirectProxy = "direct"
+)
+
+// ProxyFunc returns the proxy function of an HTTP transport using the given
+// proxy URL. HTTP, HTTPS and SOCKS5 proxies are supported, with credentials
+// given as user information in the URL. An empty proxy means proxies from
+// the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables, and
+// DirectProxy no proxy at all.
+func ProxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	switch proxy {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case DirectProxy:
+		return nil, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("malformed proxy %q: %w", proxy, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy %q, expected an http://, https:// or socks5:// URL", proxy)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("malformed proxy %q: missing host", proxy)
+	}
+	return http.ProxyURL(u), nil
+}
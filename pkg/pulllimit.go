@@ -0,0 +1,118 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// pullLimitImage is the repository Docker Hub provides to check pull
+	// limits. HEAD requests for its manifest do not count as pulls.
+	pullLimitImage = "ratelimitpreview/test"
+	pullLimitTag   = "latest"
+)
+
+// PullLimit is the pull rate limit reported by Docker Hub in the
+// RateLimit-Limit, RateLimit-Remaining and Docker-RateLimit-Source headers.
+type PullLimit struct {
+	// Limit is the number of pulls allowed per window.
+	Limit int `json:"limit"`
+	// Remaining is the number of pulls left in the current window.
+	Remaining int `json:"remaining"`
+	// WindowSeconds is the length of the window, in seconds.
+	WindowSeconds int `json:"windowSeconds"`
+	// Source is what the limit applies to, the client IP address for
+	// anonymous pulls or the account ID for authenticated pulls.
+	Source string `json:"source,omitempty"`
+	// Authenticated is true if the limit was queried with credentials. It is
+	// only set by GetPullLimit.
+	Authenticated bool `json:"authenticated"`
+}
+
+// Window returns the length of the window as a duration.
+func (l PullLimit) Window() time.Duration {
+	return time.Duration(l.WindowSeconds) * time.Second
+}
+
+// parseRateLimitHeader parses values such as "100;w=21600", where w is the
+// window in seconds.
+func parseRateLimitHeader(value string) (count, window int, err error) {
+	fields := strings.Split(value, ";")
+	count, err = strconv.Atoi(strings.TrimSpace(fields[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed rate limit %q", value)
+	}
+	for _, f := range fields[1:] {
+		k, v, ok := strings.Cut(strings.TrimSpace(f), "=")
+		if !ok || k != "w" {
+			continue
+		}
+		window, err = strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, fmt.Errorf("malformed rate limit window %q", value)
+		}
+	}
+	return count, window, nil
+}
+
+// parsePullLimit returns the pull limit reported in the response headers, or
+// nil if there is none or the headers are malformed.
+func parsePullLimit(header http.Header) *PullLimit {
+	limitValue := header.Get("RateLimit-Limit")
+	remainingValue := header.Get("RateLimit-Remaining")
+	if limitValue == "" || remainingValue == "" {
+		return nil
+	}
+	limit, window, err := parseRateLimitHeader(limitValue)
+	if err != nil {
+		return nil
+	}
+	remaining, remainingWindow, err := parseRateLimitHeader(remainingValue)
+	if err != nil {
+		return nil
+	}
+	if window == 0 {
+		window = remainingWindow
+	}
+	return &PullLimit{
+		Limit:         limit,
+		Remaining:     remaining,
+		WindowSeconds: window,
+		Source:        header.Get("Docker-RateLimit-Source"),
+	}
+}
+
+// GetPullLimit returns the Docker Hub pull limit applying to the credentials
+// for the registry, or to anonymous pulls if there are none, by requesting
+// the manifest of ratelimitpreview/test, which does not count as a pull.
+// Mirrors are not consulted. A nil limit means the registry did not report
+// one, as is the case for accounts without pull limits.
+func (r RegistryClient) GetPullLimit() (*PullLimit, error) {
+	r.Mirrors = nil
+	r.ImagePath = pullLimitImage
+	r.RepositoryCredentials = nil
+	auth, err := r.PullAuthorization()
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf(manifestAPI, r.baseURL(), r.ImagePath, pullLimitTag)
+	headers := map[string]string{
+		"Accept":        strings.Join(manifestAcceptTypes, ", "),
+		"Authorization": auth.String(),
+	}
+	status, header, _, err := r.retrieveWithHeader(http.MethodHead, endpoint, headers)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response registry API: %d", status)
+	}
+	limit := parsePullLimit(header)
+	if limit != nil {
+		limit.Authenticated = !auth.Anonymous
+	}
+	return limit, nil
+}
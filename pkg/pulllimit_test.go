@@ -0,0 +1,197 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePullLimit(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title  string
+		header http.Header
+		expect *PullLimit
+	}{
+		{
+			title: "Anonymous",
+			header: http.Header{
+				"Ratelimit-Limit":         {"100;w=21600"},
+				"Ratelimit-Remaining":     {"76;w=21600"},
+				"Docker-Ratelimit-Source": {"192.0.2.1"},
+			},
+			expect: &PullLimit{Limit: 100, Remaining: 76, WindowSeconds: 21600, Source: "192.0.2.1"},
+		},
+		{
+			title: "WindowOnRemaining",
+			header: http.Header{
+				"Ratelimit-Limit":     {"200"},
+				"Ratelimit-Remaining": {"0; w=21600"},
+			},
+			expect: &PullLimit{Limit: 200, WindowSeconds: 21600},
+		},
+		{
+			title:  "Unlimited",
+			header: http.Header{},
+		},
+		{
+			title: "MissingRemaining",
+			header: http.Header{
+				"Ratelimit-Limit": {"100;w=21600"},
+			},
+		},
+		{
+			title: "Malformed",
+			header: http.Header{
+				"Ratelimit-Limit":     {"many;w=21600"},
+				"Ratelimit-Remaining": {"76;w=21600"},
+			},
+		},
+		{
+			title: "MalformedWindow",
+			header: http.Header{
+				"Ratelimit-Limit":     {"100;w=6h"},
+				"Ratelimit-Remaining": {"76;w=21600"},
+			},
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, c.expect, parsePullLimit(c.header))
+		})
+	}
+}
+
+// mockPullLimitRegistry serves ratelimitpreview/test, reporting a limit of
+// 100 pulls for anonymous tokens and 200 pulls for the "user" token. Basic
+// auth credentials are rejected.
+func mockPullLimitRegistry(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Bearer realm="https://%s/token",service="%s"`, r.Host, r.Host))
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("scope") != "repository:ratelimitpreview/test:pull" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"anonymous"}`))
+	})
+	mux.HandleFunc("/v2/ratelimitpreview/test/manifests/latest", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("unexpected method %s", r.Method)
+		}
+		switch r.Header.Get("Authorization") {
+		case "Bearer anonymous":
+			w.Header().Set("RateLimit-Limit", "100;w=21600")
+			w.Header().Set("RateLimit-Remaining", "99;w=21600")
+			w.Header().Set("Docker-RateLimit-Source", "192.0.2.1")
+		case "Bearer user":
+			w.Header().Set("RateLimit-Limit", "200;w=21600")
+			w.Header().Set("RateLimit-Remaining", "150;w=21600")
+			w.Header().Set("Docker-RateLimit-Source", "3d2b7a9e-0b43-4b0e-a6b2-2c2a1d3a4b5c")
+		case "Bearer unlimited":
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetPullLimit(t *testing.T) {
+	cases := []struct {
+		title    string
+		token    string
+		user     string
+		password string
+		expect   *PullLimit
+		isErr    bool
+	}{
+		{
+			title:  "Anonymous",
+			expect: &PullLimit{Limit: 100, Remaining: 99, WindowSeconds: 21600, Source: "192.0.2.1"},
+		},
+		{
+			title:  "Authenticated",
+			token:  "user",
+			expect: &PullLimit{Limit: 200, Remaining: 150, WindowSeconds: 21600, Source: "3d2b7a9e-0b43-4b0e-a6b2-2c2a1d3a4b5c", Authenticated: true},
+		},
+		{
+			title: "Unlimited",
+			token: "unlimited",
+		},
+		{
+			title: "Rejected",
+			token: "revoked",
+			isErr: true,
+		},
+		{
+			title:    "RejectedCredentials",
+			user:     "hoge",
+			password: "fuga",
+			isErr:    true,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			server := mockPullLimitRegistry(t)
+			url := server.Listener.Addr().String()
+			client := RegistryClient{
+				RegistryName: NormalizeRegistryName(url),
+				RegistryURL:  url,
+				ImagePath:    "hsn723/hoge",
+				Mirrors:      []string{"mirror.invalid"},
+				HttpClient:   http.DefaultClient,
+			}
+			if c.token != "" {
+				t.Setenv(fmt.Sprintf("%s_TOKEN", client.RegistryName), c.token)
+			}
+			if c.user != "" {
+				t.Setenv(fmt.Sprintf("%s_USER", client.RegistryName), c.user)
+				t.Setenv(fmt.Sprintf("%s_PASSWORD", client.RegistryName), c.password)
+			}
+			actual, err := client.GetPullLimit()
+			assertExpectedErr(t, err, c.isErr)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
+
+func TestCheckTagPullLimit(t *testing.T) {
+	t.Parallel()
+	registry := mockRegistry{
+		t:      t,
+		scope:  "repository:hsn723/public-hoge:pull",
+		tags:   []string{"1.0.0"},
+		bearer: "aG9nZWJlYXJlcg==",
+		header: http.Header{
+			"Ratelimit-Limit":     {"100;w=21600"},
+			"Ratelimit-Remaining": {"42;w=21600"},
+		},
+	}
+	registry.init()
+	url := registry.server.Listener.Addr().String()
+	client := RegistryClient{
+		RegistryName: NormalizeRegistryName(url),
+		RegistryURL:  url,
+		ImagePath:    "hsn723/public-hoge",
+		HttpClient:   http.DefaultClient,
+	}
+	res, err := client.CheckTag("1.0.0")
+	assert.NoError(t, err)
+	assert.True(t, res.Found)
+	assert.Equal(t, &PullLimit{Limit: 100, Remaining: 42, WindowSeconds: 21600}, res.PullLimit)
+}
@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	dockerConfigJSONSecretType = "kubernetes.io/dockerconfigjson"
+	dockerConfigJSONKey        = ".dockerconfigjson"
+)
+
+// PullSecret holds registry credentials read from a Kubernetes image pull
+// secret.
+type PullSecret struct {
+	config dockerConfig
+}
+
+// kubernetesSecret is the subset of a Kubernetes Secret manifest holding
+// image pull credentials.
+type kubernetesSecret struct {
+	Kind       string            `yaml:"kind"`
+	Type       string            `yaml:"type"`
+	Data       map[string]string `yaml:"data"`
+	StringData map[string]string `yaml:"stringData"`
+}
+
+// LoadPullSecret reads a Secret manifest of type kubernetes.io/dockerconfigjson,
+// in YAML or JSON, from the file at path.
+func LoadPullSecret(path string) (*PullSecret, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var secret kubernetesSecret
+	if err := yaml.Unmarshal(b, &secret); err != nil {
+		return nil, fmt.Errorf("failed to read pull secret %s: %w", path, err)
+	}
+	if secret.Kind != "" && secret.Kind != "Secret" {
+		return nil, fmt.Errorf("%s is a %s, not a Secret", path, secret.Kind)
+	}
+	if secret.Type != dockerConfigJSONSecretType {
+		return nil, fmt.Errorf("unsupported secret type %q in %s, expected %s", secret.Type, path, dockerConfigJSONSecretType)
+	}
+	content, ok := secret.StringData[dockerConfigJSONKey]
+	if !ok {
+		encoded, ok := secret.Data[dockerConfigJSONKey]
+		if !ok {
+			return nil, fmt.Errorf("no %s key in pull secret %s", dockerConfigJSONKey, path)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s in pull secret %s: %w", dockerConfigJSONKey, path, err)
+		}
+		content = string(decoded)
+	}
+	var c dockerConfig
+	if err := json.Unmarshal([]byte(content), &c); err != nil {
+		return nil, fmt.Errorf("failed to read %s in pull secret %s: %w", dockerConfigJSONKey, path, err)
+	}
+	return &PullSecret{config: c}, nil
+}
+
+// pullSecretAuth returns the credentials for the registry in the pull secret.
+func (r RegistryClient) pullSecretAuth() (dockerAuth, bool) {
+	if r.PullSecret == nil {
+		return dockerAuth{}, false
+	}
+	return r.PullSecret.config.lookup(r.RegistryURL)
+}
@@ -0,0 +1,144 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadPullSecret(t *testing.T) {
+	t.Parallel()
+	dockerConfigJSON := `{"auths":{"ghcr.io":{"auth":"aG9nZTpoaWdl"}}}`
+	encoded := base64.StdEncoding.EncodeToString([]byte(dockerConfigJSON))
+	expect := &PullSecret{config: dockerConfig{Auths: map[string]dockerAuth{"ghcr.io": {Auth: "aG9nZTpoaWdl"}}}}
+	cases := []struct {
+		title    string
+		manifest string
+		expect   *PullSecret
+		isErr    bool
+	}{
+		{
+			title: "YAML",
+			manifest: `apiVersion: v1
+kind: Secret
+metadata:
+  name: regcred
+type: kubernetes.io/dockerconfigjson
+data:
+  .dockerconfigjson: ` + encoded + "\n",
+			expect: expect,
+		},
+		{
+			title:    "JSON",
+			manifest: `{"apiVersion":"v1","kind":"Secret","metadata":{"name":"regcred"},"type":"kubernetes.io/dockerconfigjson","data":{".dockerconfigjson":"` + encoded + `"}}`,
+			expect:   expect,
+		},
+		{
+			title: "StringData",
+			manifest: `kind: Secret
+type: kubernetes.io/dockerconfigjson
+stringData:
+  .dockerconfigjson: '` + dockerConfigJSON + "'\n",
+			expect: expect,
+		},
+		{
+			title: "WrongType",
+			manifest: `kind: Secret
+type: Opaque
+data:
+  .dockerconfigjson: ` + encoded + "\n",
+			isErr: true,
+		},
+		{
+			title: "WrongKind",
+			manifest: `kind: ConfigMap
+type: kubernetes.io/dockerconfigjson
+data:
+  .dockerconfigjson: ` + encoded + "\n",
+			isErr: true,
+		},
+		{
+			title: "MissingKey",
+			manifest: `kind: Secret
+type: kubernetes.io/dockerconfigjson
+data:
+  config.json: ` + encoded + "\n",
+			isErr: true,
+		},
+		{
+			title: "MalformedBase64",
+			manifest: `kind: Secret
+type: kubernetes.io/dockerconfigjson
+data:
+  .dockerconfigjson: hoge!
+`,
+			isErr: true,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "secret")
+			if err := os.WriteFile(path, []byte(c.manifest), 0600); err != nil {
+				t.Fatal(err)
+			}
+			actual, err := LoadPullSecret(path)
+			assertExpectedErr(t, err, c.isErr)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
+
+func TestGetAuthTokenFromPullSecret(t *testing.T) {
+	t.Parallel()
+	secret := &PullSecret{config: dockerConfig{Auths: map[string]dockerAuth{
+		"ghcr.io":           {Auth: "aG9nZTpoaWdl"},
+		"registry.dev:3000": {Username: "hoge", Password: "hige"},
+		"quay.io":           {IdentityToken: "aG9nZXJlZnJlc2g="},
+	}}}
+	cases := []struct {
+		title    string
+		registry string
+		expect   string
+		isErr    bool
+	}{
+		{
+			title:    "Auth",
+			registry: "ghcr.io",
+			expect:   "aG9nZTpoaWdl",
+		},
+		{
+			title:    "UsernamePassword",
+			registry: "registry.dev:3000",
+			expect:   "aG9nZTpoaWdl",
+		},
+		{
+			title:    "IdentityTokenOnly",
+			registry: "quay.io",
+			isErr:    true,
+		},
+		{
+			title:    "Missing",
+			registry: "docker.io",
+			isErr:    true,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			client := RegistryClient{
+				RegistryName: "PULL_SECRET_TEST",
+				RegistryURL:  c.registry,
+				PullSecret:   secret,
+			}
+			actual, err := client.getAuthTokenFromCredentials()
+			assertExpectedErr(t, err, c.isErr)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package pkg
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig describes how requests to a host are limited.
+type RateLimitConfig struct {
+	// RequestsPerSecond is the rate at which requests are allowed. Requests
+	// are not rate limited if zero.
+	RequestsPerSecond float64 `yaml:"requestsPerSecond"`
+	// Burst is the number of requests allowed at once before the rate
+	// applies. Defaults to 1.
+	Burst int `yaml:"burst"`
+	// MaxConcurrency is the maximum number of requests in flight. Requests
+	// are not limited in number if zero.
+	MaxConcurrency int `yaml:"maxConcurrency"`
+}
+
+func (c RateLimitConfig) enabled() bool {
+	return c.RequestsPerSecond > 0 || c.MaxConcurrency > 0
+}
+
+// RateLimiter limits requests per host. It is safe for concurrent use and
+// meant to be shared by clients so that their requests to the same host
+// count towards the same limits.
+type RateLimiter struct {
+	mu    sync.Mutex
+	hosts map[string]*hostLimiter
+}
+
+// hostLimiter is a token bucket combined with a semaphore.
+type hostLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	slots  chan struct{}
+}
+
+// NewRateLimiter returns an empty RateLimiter.
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{hosts: make(map[string]*hostLimiter)}
+}
+
+func newHostLimiter(c RateLimitConfig) *hostLimiter {
+	burst := math.Max(float64(c.Burst), 1)
+	h := &hostLimiter{
+		rate:   c.RequestsPerSecond,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+	if c.MaxConcurrency > 0 {
+		h.slots = make(chan struct{}, c.MaxConcurrency)
+	}
+	return h
+}
+
+// acquire waits until a request to host is allowed by c, or ctx is done.
+// The limits of a host are set by the first call for that host. The returned
+// function must be called once the request is complete.
+func (l *RateLimiter) acquire(ctx context.Context, host string, c RateLimitConfig) (func(), error) {
+	if l == nil || !c.enabled() {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	h, ok := l.hosts[host]
+	if !ok {
+		h = newHostLimiter(c)
+		l.hosts[host] = h
+	}
+	l.mu.Unlock()
+
+	release := func() {}
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		release = func() { <-h.slots }
+	}
+	if err := h.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// wait takes a token from the bucket, waiting for one to be available.
+func (h *hostLimiter) wait(ctx context.Context) error {
+	if h.rate <= 0 {
+		return nil
+	}
+	h.mu.Lock()
+	now := time.Now()
+	h.tokens = math.Min(h.burst, h.tokens+now.Sub(h.last).Seconds()*h.rate)
+	h.last = now
+	h.tokens--
+	delay := time.Duration(-h.tokens / h.rate * float64(time.Second))
+	h.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the reserved token back.
+		h.mu.Lock()
+		h.tokens++
+		h.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterRate(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title    string
+		config   RateLimitConfig
+		requests int
+		minimum  time.Duration
+	}{
+		{
+			title:    "Disabled",
+			requests: 10,
+		},
+		{
+			title:    "DefaultBurst",
+			config:   RateLimitConfig{RequestsPerSecond: 20},
+			requests: 5,
+			minimum:  200 * time.Millisecond,
+		},
+		{
+			title:    "Burst",
+			config:   RateLimitConfig{RequestsPerSecond: 20, Burst: 3},
+			requests: 5,
+			minimum:  100 * time.Millisecond,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			l := NewRateLimiter()
+			start := time.Now()
+			for i := 0; i < c.requests; i++ {
+				release, err := l.acquire(context.Background(), "registry.example.com", c.config)
+				assert.NoError(t, err)
+				release()
+			}
+			elapsed := time.Since(start)
+			assert.GreaterOrEqual(t, elapsed, c.minimum-10*time.Millisecond)
+			assert.Less(t, elapsed, c.minimum+500*time.Millisecond)
+		})
+	}
+}
+
+func TestRateLimiterPerHost(t *testing.T) {
+	t.Parallel()
+	l := NewRateLimiter()
+	config := RateLimitConfig{RequestsPerSecond: 1}
+	start := time.Now()
+	for _, host := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		release, err := l.acquire(context.Background(), host, config)
+		assert.NoError(t, err)
+		release()
+	}
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	t.Parallel()
+	l := NewRateLimiter()
+	config := RateLimitConfig{RequestsPerSecond: 0.1, MaxConcurrency: 1}
+	release, err := l.acquire(context.Background(), "registry.example.com", config)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = l.acquire(ctx, "registry.example.com", config)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	release()
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = l.acquire(ctx, "registry.example.com", config)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRateLimiterConcurrency(t *testing.T) {
+	t.Parallel()
+	var inFlight, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	t.Cleanup(server.Close)
+
+	client := RegistryClient{
+		HttpClient:  server.Client(),
+		RateLimiter: NewRateLimiter(),
+		RateLimit:   RateLimitConfig{MaxConcurrency: 2},
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, _, err := client.retrieve(http.MethodGet, server.URL, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, status)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+}
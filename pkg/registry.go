@@ -1,19 +1,23 @@
 package pkg
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
-	quayAuthAPI = "https://%s/v2/auth?service=%s&scope=repository:%s:pull"
-	authAPI     = "https://%s/token?scope=repository:%s:pull"
-	manifestAPI = "https://%s/v2/%s/manifests/%s"
+	manifestAPI = "%s/v2/%s/manifests/%s"
 )
 
 type IRegistryClient interface {
@@ -26,10 +30,83 @@ type RegistryClient struct {
 	ImagePath    string
 	HttpClient   *http.Client
 	Platforms    []string
+	// Mirrors is an ordered list of mirrors tried before RegistryURL. Mirrors
+	// are given as hosts, optionally prefixed with http:// for plain HTTP.
+	Mirrors []string
+	// MirrorClient, if set, returns the client for a mirror, given as in
+	// Mirrors, so that mirrors use their own settings. Otherwise, mirrors
+	// use the settings of the registry, except for credentials and the
+	// token endpoint.
+	MirrorClient func(mirror string) (*RegistryClient, error)
+	// PlainHTTP uses plain HTTP instead of HTTPS to talk to the registry.
+	PlainHTTP bool
+	// TokenEndpoint overrides the endpoint bearer tokens are requested from.
+	TokenEndpoint string
+	// Retry is the policy used to retry requests that failed with a network
+	// error, 429 or a 5xx status. Requests are not retried by default.
+	Retry RetryPolicy
+	// TokenCache, if set, holds bearer tokens until they expire.
+	TokenCache *TokenCache
+	// RateLimiter, if set, limits requests per host according to RateLimit,
+	// including retries and requests to mirrors and token endpoints.
+	RateLimiter *RateLimiter
+	// RateLimit is the rate and concurrency limit applied by RateLimiter.
+	RateLimit RateLimitConfig
+	// PullSecret, if set, holds credentials consulted after environment
+	// variables.
+	PullSecret *PullSecret
+	// TracerProvider, if set, provides the tracer used to record spans for
+	// tag lookups and HTTP requests. No spans are recorded by default.
+	TracerProvider trace.TracerProvider
+	// RepositoryCredentials maps repository prefixes to names used in place
+	// of RegistryName when looking up credentials for images under the
+	// longest matching prefix, with RegistryName as fallback.
+	RepositoryCredentials map[string]string
+
+	// ctx is the context requests are made with.
+	ctx context.Context
+	// challenge, if set, holds the authentication challenge of the registry
+	// for the current lookup.
+	challenge *challengeCache
+}
+
+// TagResult is the result of looking up a tag.
+type TagResult struct {
+	Found bool `json:"found"`
+	// Endpoint is the registry or mirror that answered.
+	Endpoint string `json:"endpoint"`
+	// PullLimit is the pull limit reported by the endpoint, if any.
+	PullLimit *PullLimit `json:"pullLimit,omitempty"`
 }
 
 type tokenResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+	IssuedAt     string `json:"issued_at,omitempty"`
+}
+
+// expiry returns when the token expires, minus a safety margin.
+func (t tokenResponse) expiry() time.Time {
+	issuedAt, err := time.Parse(time.RFC3339, t.IssuedAt)
+	if err != nil {
+		issuedAt = time.Now()
+	}
+	lifetime := defaultTokenLifetime
+	if t.ExpiresIn > 0 {
+		lifetime = time.Duration(t.ExpiresIn) * time.Second
+	}
+	return issuedAt.Add(lifetime - tokenExpiryMargin)
+}
+
+// bearer returns the token, which registries send either as token or, for
+// OAuth2 compatibility, as access_token.
+func (t tokenResponse) bearer() string {
+	if t.Token != "" {
+		return t.Token
+	}
+	return t.AccessToken
 }
 
 type manifestResponse struct {
@@ -37,40 +114,186 @@ type manifestResponse struct {
 }
 
 type manifest struct {
-	Platform platform `json:"platform"`
+	MediaType string   `json:"mediaType"`
+	Digest    string   `json:"digest"`
+	Platform  platform `json:"platform"`
 }
 
 type platform struct {
 	Architecture string `json:"architecture"`
 	Os           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p platform) String() string {
+	if p.Variant == "" {
+		return fmt.Sprintf("%s/%s", p.Os, p.Architecture)
+	}
+	return fmt.Sprintf("%s/%s/%s", p.Os, p.Architecture, p.Variant)
+}
+
+// apiRoot returns the host, and optional path prefix, serving the Registry
+// API for the registry.
+func (r RegistryClient) apiRoot() string {
+	return r.adapter().APIRoot(r.RegistryURL)
+}
+
+func (r RegistryClient) baseURL() string {
+	if r.PlainHTTP {
+		return fmt.Sprintf("http://%s", r.apiRoot())
+	}
+	return fmt.Sprintf("https://%s", r.apiRoot())
+}
+
+// endpoints returns clients for each mirror, in order, followed by the
+// upstream registry.
+func (r RegistryClient) endpoints() ([]RegistryClient, error) {
+	upstream := r
+	upstream.Mirrors = nil
+	upstream.MirrorClient = nil
+	endpoints := make([]RegistryClient, 0, len(r.Mirrors)+1)
+	for _, m := range r.Mirrors {
+		mirror, err := r.mirror(m)
+		if err != nil {
+			return nil, fmt.Errorf("mirror %s: %w", m, err)
+		}
+		endpoints = append(endpoints, mirror)
+	}
+	return append(endpoints, upstream), nil
+}
+
+// mirror returns the client for a mirror, looking up the same repository and
+// platforms as the registry. Mirrors never inherit the credentials or the
+// token endpoint of the registry, which would send the mirror's credentials
+// to the registry.
+func (r RegistryClient) mirror(m string) (RegistryClient, error) {
+	host := strings.TrimPrefix(strings.TrimPrefix(m, "http://"), "https://")
+	var mirror RegistryClient
+	if r.MirrorClient != nil {
+		c, err := r.MirrorClient(m)
+		if err != nil {
+			return RegistryClient{}, err
+		}
+		mirror = *c
+		mirror.ImagePath = r.ImagePath
+		mirror.Platforms = r.Platforms
+		mirror.ctx = r.ctx
+	} else {
+		mirror = r
+		mirror.PlainHTTP = false
+		mirror.RegistryName = NormalizeRegistryName(host)
+		mirror.RepositoryCredentials = nil
+		mirror.TokenEndpoint = ""
+	}
+	mirror.RegistryURL = host
+	mirror.PlainHTTP = mirror.PlainHTTP || strings.HasPrefix(m, "http://")
+	mirror.Mirrors = nil
+	mirror.MirrorClient = nil
+	mirror.challenge = nil
+	return mirror, nil
 }
 
 func (r RegistryClient) retrieve(method, endpoint string, headers map[string]string) (int, []byte, error) {
-	req, err := http.NewRequest(method, endpoint, nil)
+	status, _, b, err := r.retrieveWithHeader(method, endpoint, headers)
+	return status, b, err
+}
+
+func (r RegistryClient) retrieveWithHeader(method, endpoint string, headers map[string]string) (int, http.Header, []byte, error) {
+	return r.retrieveWithBody(method, endpoint, headers, nil)
+}
+
+func (r RegistryClient) retrieveWithBody(method, endpoint string, headers map[string]string, body []byte) (int, http.Header, []byte, error) {
+	backoff := r.Retry.Backoff
+	for attempt := 1; ; attempt++ {
+		status, header, b, err := r.retrieveOnce(method, endpoint, headers, body, attempt)
+		retryable := err != nil || status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+		if !retryable || attempt >= r.Retry.Attempts {
+			return status, header, b, err
+		}
+		timer := time.NewTimer(retryDelay(status, header, backoff, r.Retry.maxDelay()))
+		select {
+		case <-r.context().Done():
+			timer.Stop()
+			return status, header, b, r.context().Err()
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, r.Retry.maxDelay())
+	}
+}
+
+// retryDelay returns how long to wait before retrying: the delay given by
+// the Retry-After header of a 429 response, in seconds or as an HTTP date,
+// or backoff otherwise, at most maxDelay.
+func retryDelay(status int, header http.Header, backoff, maxDelay time.Duration) time.Duration {
+	delay := backoff
+	if status == http.StatusTooManyRequests {
+		retryAfter := header.Get("Retry-After")
+		if seconds, err := strconv.ParseInt(retryAfter, 10, 64); err == nil && seconds >= 0 {
+			delay = time.Duration(min(seconds, int64(maxDelay/time.Second)+1)) * time.Second
+		} else if t, err := http.ParseTime(retryAfter); err == nil {
+			delay = max(time.Until(t), 0)
+		}
+	}
+	return min(delay, maxDelay)
+}
+
+func (r RegistryClient) retrieveOnce(method, endpoint string, headers map[string]string, body []byte, attempt int) (status int, header http.Header, b []byte, err error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(r.context(), method, endpoint, reqBody)
 	if err != nil {
-		return -1, nil, err
+		return -1, nil, nil, err
 	}
 	for k, v := range headers {
 		req.Header.Add(k, v)
 	}
+	req, span := r.startRequestSpan(req, attempt)
+	defer func() {
+		if status > 0 {
+			span.SetAttributes(attribute.Int("http.response.status_code", status))
+		}
+		endSpan(span, err)
+	}()
+	release, err := r.RateLimiter.acquire(req.Context(), req.URL.Host, r.RateLimit)
+	if err != nil {
+		return -1, nil, nil, err
+	}
+	defer release()
 	res, err := r.HttpClient.Do(req)
 	if err != nil {
-		return -1, nil, err
+		return -1, nil, nil, err
 	}
 	defer res.Body.Close()
-	b, err := io.ReadAll(res.Body)
+	b, err = io.ReadAll(res.Body)
 	if err != nil {
-		return -1, nil, err
+		return -1, nil, nil, err
 	}
-	return res.StatusCode, b, nil
+	return res.StatusCode, res.Header, b, nil
+}
+
+// bearerTokenURL returns the URL bearer tokens are requested from with basic
+// authentication: the configured endpoint, the adapter's, or the realm of the
+// registry's authentication challenge, falling back to /token if the
+// registry sends none.
+func (r RegistryClient) bearerTokenURL() (string, error) {
+	if r.TokenEndpoint != "" {
+		return r.tokenURL(Challenge{Realm: r.TokenEndpoint, Service: r.RegistryURL})
+	}
+	if endpoint := r.adapter().TokenURL(r.baseURL(), r.RegistryURL, r.scope()); endpoint != "" {
+		return endpoint, nil
+	}
+	if c, err := r.getChallenge(); err == nil && c.Scheme == "bearer" && c.Realm != "" {
+		return r.tokenURL(c)
+	}
+	return fmt.Sprintf(authAPI, r.baseURL(), r.scope()), nil
 }
 
 func (r RegistryClient) retrieveBearerToken(auth string) (string, error) {
-	var endpoint string
-	if r.RegistryName == "QUAY_IO" {
-		endpoint = fmt.Sprintf(quayAuthAPI, r.RegistryURL, r.RegistryURL, r.ImagePath)
-	} else {
-		endpoint = fmt.Sprintf(authAPI, r.RegistryURL, r.ImagePath)
+	endpoint, err := r.bearerTokenURL()
+	if err != nil {
+		return "", err
 	}
 	headers := map[string]string{
 		"Authorization": fmt.Sprintf("Basic %s", auth),
@@ -86,7 +309,8 @@ func (r RegistryClient) retrieveBearerToken(auth string) (string, error) {
 	if err := json.Unmarshal(res, &token); err != nil {
 		return "", err
 	}
-	return token.Token, nil
+	r.cacheToken(r.credentialName(), token)
+	return token.bearer(), nil
 }
 
 func (r RegistryClient) hasPlatform(platform string, manifests []manifest) bool {
@@ -113,78 +337,120 @@ func (r RegistryClient) hasPlatforms(res []byte) (bool, error) {
 }
 
 func (r RegistryClient) checkManifestForTag(bearer, tag string) (bool, error) {
-	endpoint := fmt.Sprintf(manifestAPI, r.RegistryURL, r.ImagePath, tag)
+	found, _, err := r.checkManifest(bearer, tag)
+	return found, err
+}
+
+// checkManifest is like checkManifestForTag, also returning the response
+// headers.
+func (r RegistryClient) checkManifest(bearer, tag string) (bool, http.Header, error) {
+	endpoint := fmt.Sprintf(manifestAPI, r.baseURL(), r.ImagePath, tag)
 	headers := map[string]string{
 		"Accept": "application/vnd.oci.image.index.v1+json",
 	}
 	if bearer != "" {
-		headers["Authorization"] = fmt.Sprintf("Bearer %s", bearer)
+		headers["Authorization"] = authorizationHeader(bearer)
 	}
 	method := http.MethodHead
 	if r.Platforms != nil {
 		method = http.MethodGet
 	}
-	status, res, err := r.retrieve(method, endpoint, headers)
+	status, header, res, err := r.retrieveWithHeader(method, endpoint, headers)
 	if err != nil {
-		return false, err
+		return false, nil, err
 	}
 	if status == http.StatusNotFound {
-		return false, nil
+		return false, header, nil
 	}
 	if status == http.StatusOK {
 		if r.Platforms == nil {
-			return true, nil
+			return true, header, nil
 		}
-		return r.hasPlatforms(res)
+		found, err := r.hasPlatforms(res)
+		return found, header, err
 	}
-	return false, fmt.Errorf("unexpected response registry API: %d", status)
+	return false, header, fmt.Errorf("unexpected response registry API: %d", status)
 }
 
 func (r RegistryClient) getAuthTokenFromCredentials() (string, error) {
-	userEnvName := fmt.Sprintf("%s_USER", r.RegistryName)
-	passEnvName := fmt.Sprintf("%s_PASSWORD", r.RegistryName)
-	user := os.Getenv(userEnvName)
-	pass := os.Getenv(passEnvName)
-	if user == "" || pass == "" {
-		return "", fmt.Errorf("could not get credentials for %s", r.RegistryName)
+	for _, prefix := range r.envPrefixes() {
+		user := envValue(fmt.Sprintf("%s_USER", prefix))
+		pass := envValue(fmt.Sprintf("%s_PASSWORD", prefix))
+		if user == "" || pass == "" {
+			continue
+		}
+		b64 := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", user, pass)))
+		return b64, nil
+	}
+	if auth, ok := r.pullSecretAuth(); ok && auth.authToken() != "" {
+		return auth.authToken(), nil
 	}
-	b64 := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", user, pass)))
-	return b64, nil
+	return "", fmt.Errorf("%w for %s", ErrCredentialsNotFound, r.RegistryName)
 }
 
 func (r RegistryClient) getBearerTokenFromAuthToken() (string, error) {
-	authTokenEnvName := fmt.Sprintf("%s_AUTH", r.RegistryName)
-	authToken := os.Getenv(authTokenEnvName)
+	authToken := r.getenv("AUTH")
 	if authToken == "" {
 		t, err := r.getAuthTokenFromCredentials()
 		if err != nil {
-			return "", err
+			return r.getBearerTokenFromAdapter(err)
 		}
 		if t == "" {
 			return "", fmt.Errorf("could not get auth token for %s", r.RegistryName)
 		}
 		authToken = t
 	}
-	return r.retrieveBearerToken(authToken)
+	return r.exchangeAuthToken(authToken)
+}
+
+// exchangeAuthToken returns a bearer token obtained with the basic auth
+// token, or the basic auth token itself for registries using basic
+// authentication.
+func (r RegistryClient) exchangeAuthToken(authToken string) (string, error) {
+	if r.usesBasicAuth() {
+		return fmt.Sprintf("Basic %s", authToken), nil
+	}
+	bearerToken, err := r.retrieveBearerToken(authToken)
+	if err == nil {
+		return bearerToken, nil
+	}
+	// Registries implementing the OAuth2 flow may only accept credentials
+	// through a password grant.
+	user, pass, ok := splitAuthToken(authToken)
+	if !ok {
+		return "", err
+	}
+	if bearerToken, oauthErr := r.retrieveOAuth2Token(passwordGrant(user, pass)); oauthErr == nil {
+		return bearerToken, nil
+	}
+	return "", err
 }
 
 func (r RegistryClient) getBearerToken() (string, error) {
-	bearerTokenEnvName := fmt.Sprintf("%s_TOKEN", r.RegistryName)
-	bearerToken := os.Getenv(bearerTokenEnvName)
+	if err := r.checkCredentialFiles(); err != nil {
+		return "", err
+	}
+	bearerToken := r.getenv("TOKEN")
 	if bearerToken != "" {
 		return bearerToken, nil
 	}
+	if auth, ok := r.pullSecretAuth(); ok && auth.RegistryToken != "" {
+		return auth.RegistryToken, nil
+	}
+	if cached := r.cachedToken(r.credentialName()); cached != "" {
+		return cached, nil
+	}
+	if refreshToken := r.getRefreshToken(); refreshToken != "" {
+		return r.retrieveOAuth2Token(refreshTokenGrant(refreshToken))
+	}
 	bearerToken, err := r.getBearerTokenFromAuthToken()
 	if err != nil {
-		// ghcr.io is a special case where we can use GITHUB_TOKEN as the bearer token.
-		if r.RegistryName != "GHCR_IO" {
-			return "", err
-		}
-		github_token := os.Getenv("GITHUB_TOKEN")
-		if github_token == "" {
+		// Fall back to credentials injected by CI platforms, such as
+		// GITHUB_TOKEN for ghcr.io.
+		bearerToken, err = r.getBearerTokenFromCI(err)
+		if err != nil {
 			return "", err
 		}
-		bearerToken = base64.StdEncoding.EncodeToString([]byte(github_token))
 	}
 	if bearerToken != "" {
 		return bearerToken, nil
@@ -192,14 +458,103 @@ func (r RegistryClient) getBearerToken() (string, error) {
 	return "", fmt.Errorf("could not get a bearer token for %s", r.RegistryName)
 }
 
-func (r RegistryClient) IsTagExist(tag string) (bool, error) {
-	// First attempt to retrieve tag anonymously, for public images
-	if found, err := r.checkManifestForTag("", tag); err == nil {
-		return found, nil
+// authorizationHeader returns the Authorization header value for a token.
+// Tokens are sent as bearer tokens, except for basic auth tokens obtained for
+// registries using basic authentication, which are prefixed with "Basic ".
+func authorizationHeader(token string) string {
+	if strings.HasPrefix(token, "Basic ") {
+		return token
+	}
+	return fmt.Sprintf("Bearer %s", token)
+}
+
+// withAuth calls fn anonymously first, for public images, then with an
+// anonymous bearer token, and finally with a bearer token obtained from
+// credentials if the previous attempts fail.
+func (r RegistryClient) withAuth(fn func(bearer string) error) error {
+	r = r.withChallengeCache()
+	anonErr := fn("")
+	if anonErr == nil {
+		r.setAuthMethod(authMethodAnonymous)
+		return nil
+	}
+	if anonToken, err := r.getAnonymousToken(); err == nil {
+		if anonErr = fn(anonToken); anonErr == nil {
+			r.setAuthMethod(authMethodAnonymousToken)
+			return nil
+		}
 	}
 	bearerToken, err := r.getBearerToken()
 	if err != nil {
-		return false, err
+		return fmt.Errorf("%w (anonymous access failed: %v)", err, anonErr)
+	}
+	r.setAuthMethod(authMethodCredentials)
+	return fn(bearerToken)
+}
+
+func (r RegistryClient) isTagExist(tag string) (bool, *PullLimit, error) {
+	var found bool
+	var header http.Header
+	err := r.withAuth(func(bearer string) error {
+		var err error
+		found, header, err = r.checkManifest(bearer, tag)
+		return err
+	})
+	if err != nil {
+		return false, nil, err
 	}
-	return r.checkManifestForTag(bearerToken, tag)
+	return found, parsePullLimit(header), nil
+}
+
+// CheckTag looks up the tag on each mirror in order, falling back to the
+// upstream registry if the tag could not be found on any mirror.
+func (r RegistryClient) CheckTag(tag string) (TagResult, error) {
+	return r.CheckTagContext(context.Background(), tag)
+}
+
+// CheckTagContext is like CheckTag, recording spans as children of the span
+// in ctx, if any.
+func (r RegistryClient) CheckTagContext(ctx context.Context, tag string) (TagResult, error) {
+	return r.checkTag(ctx, "CheckTag", tag)
+}
+
+func (r RegistryClient) checkTag(ctx context.Context, spanName, tag string) (res TagResult, err error) {
+	ctx, span := r.tracer().Start(ctx, spanName, trace.WithAttributes(
+		attrRegistry.String(r.RegistryURL),
+		attrRepository.String(r.ImagePath),
+		attrTag.String(tag),
+	))
+	defer func() {
+		if err == nil {
+			span.SetAttributes(attrFound.Bool(res.Found), attrEndpoint.String(res.Endpoint))
+		}
+		endSpan(span, err)
+	}()
+	endpoints, err := r.withContext(ctx).endpoints()
+	if err != nil {
+		return TagResult{}, err
+	}
+	var lastErr error
+	for _, e := range endpoints {
+		found, limit, err := e.isTagExist(tag)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if found || e.RegistryURL == r.RegistryURL {
+			return TagResult{Found: found, Endpoint: e.RegistryURL, PullLimit: limit}, nil
+		}
+	}
+	return TagResult{}, lastErr
+}
+
+func (r RegistryClient) IsTagExist(tag string) (bool, error) {
+	return r.IsTagExistContext(context.Background(), tag)
+}
+
+// IsTagExistContext is like IsTagExist, recording spans as children of the
+// span in ctx, if any.
+func (r RegistryClient) IsTagExistContext(ctx context.Context, tag string) (bool, error) {
+	res, err := r.checkTag(ctx, "IsTagExist", tag)
+	return res.Found, err
 }
@@ -1,13 +1,18 @@
 package pkg
 
 import (
+	"context"
+	"crypto/sha256"
 	_ "embed"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
@@ -19,12 +24,40 @@ var (
 )
 
 type mockRegistry struct {
-	t      *testing.T
-	tags   []string
-	scope  string
-	basic  string
-	bearer string
-	server *httptest.Server
+	t        *testing.T
+	tags     []string
+	scope    string
+	basic    string
+	bearer   string
+	manifest []byte
+	pageSize int
+	// anonymous sends a bearer challenge and issues tokens without
+	// credentials, like registries serving public images.
+	anonymous bool
+	// refresh is the refresh token accepted by the OAuth2 flow.
+	refresh string
+	// oauth2Only rejects token requests outside of the OAuth2 flow.
+	oauth2Only bool
+	// tokenRequests counts requests to the token endpoint.
+	tokenRequests int32
+	// manifestGets counts GET requests for manifests.
+	manifestGets int32
+	// pings counts requests to the API version check endpoint.
+	pings int32
+	// basicOnly requires basic authentication on API requests.
+	basicOnly bool
+	// referrers serves the referrers API.
+	referrers bool
+	// header is added to manifest responses.
+	header http.Header
+	// realm is the path of the token endpoint sent in bearer challenges,
+	// which are then sent even if anonymous is false. Default is /token.
+	realm string
+	// oauth2Disabled rejects the OAuth2 flow, like GCR.
+	oauth2Disabled bool
+	// absoluteLink sends absolute URLs in Link headers.
+	absoluteLink bool
+	server       *httptest.Server
 }
 
 type mockTransport struct {
@@ -34,9 +67,26 @@ type mockTransport struct {
 func (m *mockRegistry) init() {
 	r := mux.NewRouter()
 	handleToken := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&m.tokenRequests, 1)
+		if r.Method == http.MethodPost && m.oauth2Disabled {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodPost {
+			m.handleOAuth2Token(w, r)
+			return
+		}
+		if m.oauth2Only {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		params := r.URL.Query()
 		scope := params.Get("scope")
 		auth := r.Header.Get("Authorization")
+		if m.anonymous && auth == "" {
+			scope = m.scope
+			auth = fmt.Sprintf("Basic %s", m.basic)
+		}
 		if scope != m.scope || auth != fmt.Sprintf("Basic %s", m.basic) {
 			w.WriteHeader(http.StatusForbidden)
 			return
@@ -53,9 +103,33 @@ func (m *mockRegistry) init() {
 			m.t.Fatal(err)
 		}
 	}
-	r.HandleFunc("/token", handleToken)
+	realm := "/token"
+	if m.realm != "" {
+		realm = m.realm
+	}
+	r.HandleFunc(realm, handleToken)
+	r.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&m.pings, 1)
+		if m.basicOnly {
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm="https://%s/"`, r.Host))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !m.anonymous && m.realm == "" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Bearer realm="https://%s%s",service="%s"`, r.Host, realm, r.Host))
+		w.WriteHeader(http.StatusUnauthorized)
+	})
 	r.HandleFunc("/v2/hsn723/hoge/manifests/{tag}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&m.manifestGets, 1)
+		}
 		auth := r.Header.Get("Authorization")
+		if m.basicOnly && auth == fmt.Sprintf("Basic %s", m.basic) {
+			auth = fmt.Sprintf("Bearer %s", m.bearer)
+		}
 		if auth != fmt.Sprintf("Bearer %s", m.bearer) {
 			w.WriteHeader(http.StatusForbidden)
 			return
@@ -64,27 +138,123 @@ func (m *mockRegistry) init() {
 		rt := vars["tag"]
 		for _, tag := range m.tags {
 			if tag == rt {
-				w.WriteHeader(http.StatusOK)
+				m.writeManifest(w)
 				return
 			}
 		}
 		w.WriteHeader(http.StatusNotFound)
 	})
 	r.HandleFunc("/v2/hsn723/public-hoge/manifests/{tag}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&m.manifestGets, 1)
+		}
 		vars := mux.Vars(r)
 		rt := vars["tag"]
 		for _, tag := range m.tags {
 			if tag == rt {
-				w.WriteHeader(http.StatusOK)
+				m.writeManifest(w)
 				return
 			}
 		}
 		w.WriteHeader(http.StatusNotFound)
 	})
+	r.HandleFunc("/v2/hsn723/hoge/tags/list", func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if auth != fmt.Sprintf("Bearer %s", m.bearer) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		m.writeTags(w, r)
+	})
+	r.HandleFunc("/v2/hsn723/public-hoge/tags/list", m.writeTags)
+	r.HandleFunc("/v2/hsn723/{repository}/referrers/{digest}", func(w http.ResponseWriter, r *http.Request) {
+		if !m.referrers {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.index.v1+json")
+		_, _ = w.Write([]byte(`{"schemaVersion":2,"manifests":[]}`))
+	})
+	r.HandleFunc("/v2/_catalog", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != fmt.Sprintf("Bearer %s", m.bearer) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"repositories":["hsn723/hoge"]}`))
+	})
 	server := httptest.NewServer(r)
 	m.server = server
 }
 
+func (m *mockRegistry) handleOAuth2Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		m.t.Fatal(err)
+	}
+	basic := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", r.PostForm.Get("username"), r.PostForm.Get("password"))))
+	authorized := false
+	switch r.PostForm.Get("grant_type") {
+	case "refresh_token":
+		authorized = m.refresh != "" && r.PostForm.Get("refresh_token") == m.refresh
+	case "password":
+		authorized = basic == m.basic
+	}
+	if !authorized || r.PostForm.Get("scope") != m.scope {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	resp, err := json.Marshal(tokenResponse{AccessToken: m.bearer})
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(resp); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+func (m *mockRegistry) writeTags(w http.ResponseWriter, r *http.Request) {
+	tags := m.tags
+	if last := r.URL.Query().Get("last"); last != "" {
+		for i, tag := range tags {
+			if tag == last {
+				tags = tags[i+1:]
+				break
+			}
+		}
+	}
+	if m.pageSize > 0 && len(tags) > m.pageSize {
+		tags = tags[:m.pageSize]
+		link := r.URL.Path
+		if m.absoluteLink {
+			link = fmt.Sprintf("https://%s%s", r.Host, link)
+		}
+		w.Header().Add("Link", fmt.Sprintf(`<%s?n=%d&last=%s>; rel="next"`, link, m.pageSize, tags[len(tags)-1]))
+	}
+	resp, err := json.Marshal(tagsListResponse{Tags: tags})
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(resp); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+func (m *mockRegistry) writeManifest(w http.ResponseWriter) {
+	for k, v := range m.header {
+		w.Header()[k] = v
+	}
+	if m.manifest == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Add("Docker-Content-Digest", fmt.Sprintf("sha256:%x", sha256.Sum256(m.manifest)))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(m.manifest); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
 func (t mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	req.URL.Scheme = "http"
 	rt := t.Transport
@@ -102,12 +272,25 @@ func TestMain(m *testing.M) {
 func TestRetrieveBearerToken(t *testing.T) {
 	t.Parallel()
 	cases := []struct {
-		title    string
-		registry mockRegistry
-		auth     string
-		expect   string
-		isErr    bool
+		title            string
+		registry         mockRegistry
+		auth             string
+		overrideEndpoint bool
+		expect           string
+		isErr            bool
 	}{
+		{
+			title: "TokenEndpointOverride",
+			registry: mockRegistry{
+				t:      t,
+				scope:  "repository:hsn723/hoge:pull",
+				basic:  "aG9nZTpoaWdl",
+				bearer: "aG9nZWJlYXJlcg==",
+			},
+			auth:             "aG9nZTpoaWdl",
+			overrideEndpoint: true,
+			expect:           "aG9nZWJlYXJlcg==",
+		},
 		{
 			title: "AuthSuccess",
 			registry: mockRegistry{
@@ -143,6 +326,10 @@ func TestRetrieveBearerToken(t *testing.T) {
 				ImagePath:    "hsn723/hoge",
 				HttpClient:   http.DefaultClient,
 			}
+			if c.overrideEndpoint {
+				client.RegistryURL = "registry.invalid"
+				client.TokenEndpoint = fmt.Sprintf("http://%s/token", url)
+			}
 			actual, err := client.retrieveBearerToken(c.auth)
 			assertExpectedErr(t, err, c.isErr)
 			assert.Equal(t, c.expect, actual)
@@ -150,6 +337,236 @@ func TestRetrieveBearerToken(t *testing.T) {
 	}
 }
 
+func TestBearerTokenURL(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title         string
+		tokenEndpoint string
+		registryURL   string
+		expect        string
+	}{
+		{
+			title:         "Override",
+			tokenEndpoint: "https://auth.example.com/token",
+			registryURL:   "registry.example.com",
+			expect:        "https://auth.example.com/token?scope=repository%3Ahsn723%2Fhoge%3Apull&service=registry.example.com",
+		},
+		{
+			title:         "OverrideWithQuery",
+			tokenEndpoint: "https://auth.example.com/token?tenant=x",
+			registryURL:   "registry.example.com",
+			expect:        "https://auth.example.com/token?scope=repository%3Ahsn723%2Fhoge%3Apull&service=registry.example.com&tenant=x",
+		},
+		{
+			title:         "OverrideEscaping",
+			tokenEndpoint: "https://auth.example.com/token",
+			registryURL:   "registry.example.com:5000",
+			expect:        "https://auth.example.com/token?scope=repository%3Ahsn723%2Fhoge%3Apull&service=registry.example.com%3A5000",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			client := RegistryClient{
+				RegistryURL:   c.registryURL,
+				ImagePath:     "hsn723/hoge",
+				TokenEndpoint: c.tokenEndpoint,
+			}
+			actual, err := client.bearerTokenURL()
+			assert.NoError(t, err)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
+
+func TestRetrieveRetry(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title    string
+		failures int
+		attempts int
+		expect   int
+	}{
+		{
+			title:    "NoRetry",
+			failures: 1,
+			expect:   http.StatusServiceUnavailable,
+		},
+		{
+			title:    "RetrySuccess",
+			failures: 2,
+			attempts: 3,
+			expect:   http.StatusOK,
+		},
+		{
+			title:    "RetryExhausted",
+			failures: 3,
+			attempts: 3,
+			expect:   http.StatusServiceUnavailable,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= c.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+			client := RegistryClient{
+				HttpClient: http.DefaultClient,
+				Retry:      RetryPolicy{Attempts: c.attempts, Backoff: time.Millisecond},
+			}
+			actual, _, err := client.retrieve(http.MethodGet, server.URL, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
+
+func TestRetrieveRetryCancelled(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	client := RegistryClient{
+		HttpClient: http.DefaultClient,
+		Retry:      RetryPolicy{Attempts: 3, Backoff: time.Hour},
+		ctx:        ctx,
+	}
+	start := time.Now()
+	_, _, err := client.retrieve(http.MethodGet, server.URL, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Minute)
+}
+
+func TestRetrieveRetryAfterClamped(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "86400")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	client := RegistryClient{
+		HttpClient: http.DefaultClient,
+		Retry:      RetryPolicy{Attempts: 2, Backoff: time.Millisecond, MaxDelay: 10 * time.Millisecond},
+	}
+	start := time.Now()
+	actual, _, err := client.retrieve(http.MethodGet, server.URL, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, actual)
+	assert.Less(t, time.Since(start), time.Minute)
+}
+
+func TestRetryDelay(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title      string
+		status     int
+		retryAfter string
+		backoff    time.Duration
+		expect     time.Duration
+	}{
+		{
+			title:  "ServerError",
+			status: http.StatusServiceUnavailable,
+			expect: time.Second,
+		},
+		{
+			title:      "ServerErrorRetryAfter",
+			status:     http.StatusServiceUnavailable,
+			retryAfter: "10",
+			expect:     time.Second,
+		},
+		{
+			title:      "TooManyRequestsSeconds",
+			status:     http.StatusTooManyRequests,
+			retryAfter: "10",
+			expect:     10 * time.Second,
+		},
+		{
+			title:      "TooManyRequestsPastDate",
+			status:     http.StatusTooManyRequests,
+			retryAfter: "Wed, 21 Oct 2015 07:28:00 GMT",
+			expect:     0,
+		},
+		{
+			title:      "TooManyRequestsInvalid",
+			status:     http.StatusTooManyRequests,
+			retryAfter: "soon",
+			expect:     time.Second,
+		},
+		{
+			title:  "TooManyRequestsMissing",
+			status: http.StatusTooManyRequests,
+			expect: time.Second,
+		},
+		{
+			title:      "TooManyRequestsClamped",
+			status:     http.StatusTooManyRequests,
+			retryAfter: "86400",
+			expect:     time.Minute,
+		},
+		{
+			title:      "TooManyRequestsOverflow",
+			status:     http.StatusTooManyRequests,
+			retryAfter: "9223372036854775807",
+			expect:     time.Minute,
+		},
+		{
+			title:      "TooManyRequestsFarDate",
+			status:     http.StatusTooManyRequests,
+			retryAfter: "Fri, 01 Jan 2100 00:00:00 GMT",
+			expect:     time.Minute,
+		},
+		{
+			title:   "BackoffClamped",
+			status:  http.StatusServiceUnavailable,
+			backoff: time.Hour,
+			expect:  time.Minute,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			header := http.Header{}
+			if c.retryAfter != "" {
+				header.Set("Retry-After", c.retryAfter)
+			}
+			backoff := c.backoff
+			if backoff == 0 {
+				backoff = time.Second
+			}
+			assert.Equal(t, c.expect, retryDelay(c.status, header, backoff, time.Minute))
+		})
+	}
+}
+
+func TestRetryDelayFutureDate(t *testing.T) {
+	t.Parallel()
+	header := http.Header{}
+	header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	actual := retryDelay(http.StatusTooManyRequests, header, time.Second, time.Hour)
+	assert.Greater(t, actual, 50*time.Second)
+	assert.LessOrEqual(t, actual, time.Minute)
+}
+
 func TestCheckManifestForTag(t *testing.T) {
 	t.Parallel()
 	cases := []struct {
@@ -313,6 +730,19 @@ func TestGetBearerTokenFromAuthToken(t *testing.T) {
 			passEnv: "hige",
 			expect:  "aG9nZWJlYXJlcg==",
 		},
+		{
+			title: "PasswordGrant",
+			registry: mockRegistry{
+				t:          t,
+				scope:      "repository:hsn723/hoge:pull",
+				basic:      "aG9nZTpoaWdl",
+				bearer:     "aG9nZWJlYXJlcg==",
+				oauth2Only: true,
+			},
+			userEnv: "hoge",
+			passEnv: "hige",
+			expect:  "aG9nZWJlYXJlcg==",
+		},
 		{
 			title: "WrongToken",
 			registry: mockRegistry{
@@ -358,13 +788,14 @@ func TestGetBearerTokenFromAuthToken(t *testing.T) {
 
 func TestGetBearerToken(t *testing.T) {
 	cases := []struct {
-		title        string
-		bearerEnv    string
-		githubEnv    string
-		registryName string
-		registry     mockRegistry
-		expect       string
-		isErr        bool
+		title       string
+		bearerEnv   string
+		githubEnv   string
+		refreshEnv  string
+		registryURL string
+		registry    mockRegistry
+		expect      string
+		isErr       bool
 	}{
 		{
 			title: "TokenInEnv",
@@ -377,6 +808,30 @@ func TestGetBearerToken(t *testing.T) {
 			bearerEnv: "aG9nZWJlYXJlcg==",
 			expect:    "aG9nZWJlYXJlcg==",
 		},
+		{
+			title: "RefreshTokenInEnv",
+			registry: mockRegistry{
+				t:       t,
+				scope:   "repository:hsn723/hoge:pull",
+				basic:   "aG9nZTpoaWdl",
+				bearer:  "aG9nZWJlYXJlcg==",
+				refresh: "aG9nZXJlZnJlc2g=",
+			},
+			refreshEnv: "aG9nZXJlZnJlc2g=",
+			expect:     "aG9nZWJlYXJlcg==",
+		},
+		{
+			title: "WrongRefreshToken",
+			registry: mockRegistry{
+				t:       t,
+				scope:   "repository:hsn723/hoge:pull",
+				basic:   "aG9nZTpoaWdl",
+				bearer:  "aG9nZWJlYXJlcg==",
+				refresh: "aG9nZXJlZnJlc2g=",
+			},
+			refreshEnv: "hoge",
+			isErr:      true,
+		},
 		{
 			title: "GithubToken",
 			registry: mockRegistry{
@@ -385,9 +840,9 @@ func TestGetBearerToken(t *testing.T) {
 				basic:  "aG9nZTpoaWdl",
 				bearer: "aG9nZWJlYXJlcg==",
 			},
-			registryName: "GHCR_IO",
-			githubEnv:    "ghp_hogebearer",
-			expect:       "Z2hwX2hvZ2ViZWFyZXI=",
+			registryURL: "ghcr.io",
+			githubEnv:   "ghp_hogebearer",
+			expect:      "Z2hwX2hvZ2ViZWFyZXI=",
 		},
 		{
 			title: "WrongCredentials",
@@ -405,18 +860,19 @@ func TestGetBearerToken(t *testing.T) {
 			t.Helper()
 			c.registry.init()
 			url := c.registry.server.Listener.Addr().String()
-			registryName := c.registryName
-			if registryName == "" {
-				registryName = NormalizeRegistryName(url)
+			if c.registryURL != "" {
+				url = c.registryURL
 			}
 			client := RegistryClient{
-				RegistryName: registryName,
+				RegistryName: NormalizeRegistryName(url),
 				RegistryURL:  url,
 				ImagePath:    "hsn723/hoge",
 				HttpClient:   http.DefaultClient,
 			}
 			t.Setenv(fmt.Sprintf("%s_TOKEN", client.RegistryName), c.bearerEnv)
+			t.Setenv(fmt.Sprintf("%s_REFRESH_TOKEN", client.RegistryName), c.refreshEnv)
 			t.Setenv("GITHUB_TOKEN", c.githubEnv)
+			t.Setenv("DOCKER_CONFIG", t.TempDir())
 			actual, err := client.getBearerToken()
 			assertExpectedErr(t, err, c.isErr)
 			assert.Equal(t, c.expect, actual)
@@ -428,12 +884,27 @@ func TestIsTagExist(t *testing.T) {
 	cases := []struct {
 		title     string
 		bearerEnv string
+		authEnv   string
 		path      string
 		registry  mockRegistry
 		tag       string
 		expect    bool
 		isErr     bool
 	}{
+		{
+			title:   "BasicAuth",
+			authEnv: "aG9nZTpoaWdl",
+			path:    "hsn723/hoge",
+			registry: mockRegistry{
+				t:         t,
+				basic:     "aG9nZTpoaWdl",
+				bearer:    "aG9nZWJlYXJlcg==",
+				tags:      []string{"1.0.0", "1.0.1", "0.1.0"},
+				basicOnly: true,
+			},
+			tag:    "0.1.0",
+			expect: true,
+		},
 		{
 			title:     "Found",
 			bearerEnv: "aG9nZWJlYXJlcg==",
@@ -458,6 +929,19 @@ func TestIsTagExist(t *testing.T) {
 			tag:    "0.1.0",
 			expect: true,
 		},
+		{
+			title: "AnonymousToken",
+			path:  "hsn723/hoge",
+			registry: mockRegistry{
+				t:         t,
+				scope:     "repository:hsn723/hoge:pull",
+				bearer:    "aG9nZWJlYXJlcg==",
+				tags:      []string{"1.0.0", "1.0.1", "0.1.0"},
+				anonymous: true,
+			},
+			tag:    "0.1.0",
+			expect: true,
+		},
 		{
 			title:     "NotFound",
 			bearerEnv: "aG9nZWJlYXJlcg==",
@@ -496,6 +980,7 @@ func TestIsTagExist(t *testing.T) {
 				HttpClient:   http.DefaultClient,
 			}
 			t.Setenv(fmt.Sprintf("%s_TOKEN", client.RegistryName), c.bearerEnv)
+			t.Setenv(fmt.Sprintf("%s_AUTH", client.RegistryName), c.authEnv)
 			actual, err := client.IsTagExist(c.tag)
 			assertExpectedErr(t, err, c.isErr)
 			assert.Equal(t, c.expect, actual)
@@ -503,6 +988,164 @@ func TestIsTagExist(t *testing.T) {
 	}
 }
 
+func TestCheckTag(t *testing.T) {
+	cases := []struct {
+		title    string
+		mirror   mockRegistry
+		upstream mockRegistry
+		down     bool
+		tag      string
+		expect   bool
+		mirrored bool
+	}{
+		{
+			title:    "FoundOnMirror",
+			mirror:   mockRegistry{t: t, tags: []string{"1.0.0", "1.0.1"}},
+			upstream: mockRegistry{t: t, tags: []string{"1.0.0", "1.0.1"}},
+			tag:      "1.0.1",
+			expect:   true,
+			mirrored: true,
+		},
+		{
+			title:    "FallbackToUpstream",
+			mirror:   mockRegistry{t: t, tags: []string{"1.0.0"}},
+			upstream: mockRegistry{t: t, tags: []string{"1.0.0", "1.0.1"}},
+			tag:      "1.0.1",
+			expect:   true,
+		},
+		{
+			title:    "MirrorDown",
+			mirror:   mockRegistry{t: t, tags: []string{"1.0.0", "1.0.1"}},
+			upstream: mockRegistry{t: t, tags: []string{"1.0.0", "1.0.1"}},
+			down:     true,
+			tag:      "1.0.1",
+			expect:   true,
+		},
+		{
+			title:    "NotFound",
+			mirror:   mockRegistry{t: t, tags: []string{"1.0.0"}},
+			upstream: mockRegistry{t: t, tags: []string{"1.0.0"}},
+			tag:      "1.0.1",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			t.Helper()
+			c.mirror.init()
+			c.upstream.init()
+			mirrorURL := c.mirror.server.Listener.Addr().String()
+			if c.down {
+				c.mirror.server.Close()
+			}
+			url := c.upstream.server.Listener.Addr().String()
+			client := RegistryClient{
+				RegistryName: NormalizeRegistryName(url),
+				RegistryURL:  url,
+				ImagePath:    "hsn723/public-hoge",
+				HttpClient:   http.DefaultClient,
+				Mirrors:      []string{fmt.Sprintf("http://%s", mirrorURL)},
+			}
+			expectEndpoint := url
+			if c.mirrored {
+				expectEndpoint = mirrorURL
+			}
+			actual, err := client.CheckTag(c.tag)
+			assert.NoError(t, err)
+			assert.Equal(t, TagResult{Found: c.expect, Endpoint: expectEndpoint}, actual)
+		})
+	}
+}
+
+func TestCheckTagMirrorCredentials(t *testing.T) {
+	var leaked int32
+	upstreamToken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			atomic.AddInt32(&leaked, 1)
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer upstreamToken.Close()
+	mirror := mockRegistry{
+		t:      t,
+		scope:  "repository:hsn723/hoge:pull",
+		basic:  "aG9nZTptaXJyb3I=",
+		bearer: "aG9nZWJlYXJlcg==",
+		tags:   []string{"1.0.0"},
+		realm:  "/token",
+	}
+	mirror.init()
+	upstream := mockRegistry{t: t, tags: []string{"1.0.0"}}
+	upstream.init()
+	mirrorURL := mirror.server.Listener.Addr().String()
+	t.Setenv(fmt.Sprintf("%s_AUTH", NormalizeRegistryName(mirrorURL)), "aG9nZTptaXJyb3I=")
+	url := upstream.server.Listener.Addr().String()
+	client := RegistryClient{
+		RegistryName:  NormalizeRegistryName(url),
+		RegistryURL:   url,
+		ImagePath:     "hsn723/hoge",
+		HttpClient:    http.DefaultClient,
+		TokenEndpoint: upstreamToken.URL,
+		Mirrors:       []string{fmt.Sprintf("http://%s", mirrorURL)},
+	}
+	actual, err := client.CheckTag("1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, TagResult{Found: true, Endpoint: mirrorURL}, actual)
+	assert.Zero(t, atomic.LoadInt32(&leaked))
+}
+
+func TestCheckTagChallengeOnce(t *testing.T) {
+	registry := mockRegistry{
+		t:      t,
+		scope:  "repository:hsn723/hoge:pull",
+		basic:  "aG9nZTpmdWdh",
+		bearer: "aG9nZWJlYXJlcg==",
+		tags:   []string{"1.0.0"},
+		realm:  "/token",
+	}
+	registry.init()
+	url := registry.server.Listener.Addr().String()
+	t.Setenv(fmt.Sprintf("%s_AUTH", NormalizeRegistryName(url)), "aG9nZTpmdWdh")
+	client := RegistryClient{
+		RegistryName: NormalizeRegistryName(url),
+		RegistryURL:  url,
+		ImagePath:    "hsn723/hoge",
+		HttpClient:   http.DefaultClient,
+	}
+	actual, err := client.CheckTag("1.0.0")
+	assert.NoError(t, err)
+	assert.True(t, actual.Found)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&registry.pings))
+}
+
+func TestCheckTagMirrorClient(t *testing.T) {
+	mirror := mockRegistry{t: t, tags: []string{"1.0.0"}}
+	mirror.init()
+	upstream := mockRegistry{t: t, tags: []string{"1.0.0"}}
+	upstream.init()
+	mirrorURL := mirror.server.Listener.Addr().String()
+	url := upstream.server.Listener.Addr().String()
+	var requested []string
+	client := RegistryClient{
+		RegistryName: NormalizeRegistryName(url),
+		RegistryURL:  url,
+		ImagePath:    "hsn723/public-hoge",
+		HttpClient:   &http.Client{Transport: offlineTransport{}},
+		Mirrors:      []string{mirrorURL},
+		MirrorClient: func(m string) (*RegistryClient, error) {
+			requested = append(requested, m)
+			return &RegistryClient{
+				RegistryName: "HOGE_MIRROR",
+				HttpClient:   http.DefaultClient,
+				ImagePath:    "ignored",
+			}, nil
+		},
+	}
+	actual, err := client.CheckTag("1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, TagResult{Found: true, Endpoint: mirrorURL}, actual)
+	assert.Equal(t, []string{mirrorURL}, requested)
+}
+
 func TestHasPlatforms(t *testing.T) {
 	t.Parallel()
 	cases := []struct {
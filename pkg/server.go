@@ -0,0 +1,307 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MaxBatchSize is the maximum number of references in a batch request.
+	MaxBatchSize = 100
+	// batchConcurrency is the number of references of a batch looked up
+	// concurrently. Per-registry limits still apply.
+	batchConcurrency = 8
+	// maxRequestBody is the maximum size of a batch request body.
+	maxRequestBody = 1 << 20
+	// cacheSweepSize is the number of cached results above which expired
+	// results are removed when adding a result.
+	cacheSweepSize = 10000
+)
+
+// ExistsQuery is a reference to look up, in batch requests.
+type ExistsQuery struct {
+	// Ref is the image reference, in the format IMAGE:TAG or IMAGE@DIGEST.
+	Ref string `json:"ref"`
+	// Platforms to look for, in the format os/arch. Default is any platform,
+	// or the platforms configured for the registry.
+	Platforms []string `json:"platforms,omitempty"`
+}
+
+// ExistsResult is the result of looking up a reference.
+type ExistsResult struct {
+	Ref       string   `json:"ref"`
+	Platforms []string `json:"platforms,omitempty"`
+	Found     bool     `json:"found"`
+	// Endpoint is the registry or mirror that answered.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Cached is true if the result was served from the cache.
+	Cached bool `json:"cached"`
+	// Error is set if the lookup failed, in which case Found is meaningless.
+	Error string `json:"error,omitempty"`
+}
+
+type batchRequest struct {
+	Refs []ExistsQuery `json:"refs"`
+}
+
+type batchResponse struct {
+	Results []ExistsResult `json:"results"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type cachedResult struct {
+	res     ExistsResult
+	expires time.Time
+}
+
+// resultCache caches successful lookups, found or not, for different TTLs.
+type resultCache struct {
+	mu          sync.Mutex
+	results     map[string]cachedResult
+	positiveTTL time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+}
+
+func cacheKey(q ExistsQuery) string {
+	return q.Ref + "|" + strings.Join(q.Platforms, ",")
+}
+
+func (c *resultCache) get(q ExistsQuery) (ExistsResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := cacheKey(q)
+	cached, ok := c.results[key]
+	if !ok {
+		return ExistsResult{}, false
+	}
+	if !c.now().Before(cached.expires) {
+		delete(c.results, key)
+		return ExistsResult{}, false
+	}
+	return cached.res, true
+}
+
+func (c *resultCache) put(q ExistsQuery, res ExistsResult) {
+	ttl := c.negativeTTL
+	if res.Found {
+		ttl = c.positiveTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if len(c.results) >= cacheSweepSize {
+		for k, v := range c.results {
+			if !now.Before(v.expires) {
+				delete(c.results, k)
+			}
+		}
+	}
+	c.results[cacheKey(q)] = cachedResult{res: res, expires: now.Add(ttl)}
+}
+
+// Server answers tag lookups over HTTP.
+//
+//	GET  /v1/exists?ref=IMAGE:TAG[&platform=OS/ARCH]...
+//	POST /v1/exists with a body of {"refs": [{"ref": ..., "platforms": [...]}]}
+//	GET  /healthz
+//	GET  /readyz
+//
+// Lookups that succeed are cached, for positiveTTL if the tag was found and
+// negativeTTL otherwise. Errors are not cached.
+type Server struct {
+	// NewClient returns a client for an image. Clients should share a
+	// TokenCache so that tokens are reused across requests.
+	NewClient func(image string) (*RegistryClient, error)
+
+	cache *resultCache
+	ready atomic.Bool
+}
+
+// NewServer returns a server looking up tags with clients returned by
+// newClient. A TTL of zero disables caching of the corresponding results.
+// The server is not ready until SetReady is called.
+func NewServer(newClient func(image string) (*RegistryClient, error), positiveTTL, negativeTTL time.Duration) *Server {
+	return &Server{
+		NewClient: newClient,
+		cache: &resultCache{
+			results:     make(map[string]cachedResult),
+			positiveTTL: positiveTTL,
+			negativeTTL: negativeTTL,
+			now:         time.Now,
+		},
+	}
+}
+
+// SetReady sets whether /readyz reports the server as ready, such as to
+// stop receiving traffic before shutting down.
+func (s *Server) SetReady(ready bool) {
+	s.ready.Store(ready)
+}
+
+// Handler returns the HTTP handler of the server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/exists", s.handleExists)
+	mux.HandleFunc("POST /v1/exists", s.handleBatch)
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /readyz", s.handleReady)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// splitPlatforms accepts platforms given repeatedly or comma-separated.
+func splitPlatforms(values []string) []string {
+	var res []string
+	for _, v := range values {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				res = append(res, p)
+			}
+		}
+	}
+	return res
+}
+
+// normalize validates the query and sorts platforms so that equivalent
+// queries share cached results.
+func (q ExistsQuery) normalize() (ExistsQuery, error) {
+	if q.Ref == "" {
+		return q, errors.New("missing ref")
+	}
+	image, _, err := SplitReference(q.Ref)
+	if err != nil {
+		return q, err
+	}
+	if _, err := ExtractRegistryURL(image); err != nil {
+		return q, err
+	}
+	if _, err := ExtractImagePath(image); err != nil {
+		return q, err
+	}
+	platforms := splitPlatforms(q.Platforms)
+	slices.Sort(platforms)
+	q.Platforms = slices.Compact(platforms)
+	return q, nil
+}
+
+// lookup returns the result for a normalized query, from the cache if
+// possible.
+func (s *Server) lookup(ctx context.Context, q ExistsQuery) ExistsResult {
+	if res, ok := s.cache.get(q); ok {
+		res.Cached = true
+		return res
+	}
+	res := ExistsResult{Ref: q.Ref, Platforms: q.Platforms}
+	image, reference, _ := SplitReference(q.Ref)
+	client, err := s.NewClient(image)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	if len(q.Platforms) > 0 {
+		client.Platforms = q.Platforms
+	}
+	tagRes, err := client.CheckTagContext(ctx, reference)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Found = tagRes.Found
+	res.Endpoint = tagRes.Endpoint
+	s.cache.put(q, res)
+	return res
+}
+
+func (s *Server) handleExists(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q, err := ExistsQuery{Ref: query.Get("ref"), Platforms: query["platform"]}.normalize()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	res := s.lookup(r.Context(), q)
+	status := http.StatusOK
+	if res.Error != "" {
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, res)
+}
+
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("malformed request: %w", err))
+		return
+	}
+	if len(req.Refs) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("no refs given"))
+		return
+	}
+	if len(req.Refs) > MaxBatchSize {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("too many refs, at most %d are allowed", MaxBatchSize))
+		return
+	}
+	queries := make([]ExistsQuery, len(req.Refs))
+	for i, q := range req.Refs {
+		nq, err := q.normalize()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("refs[%d]: %w", i, err))
+			return
+		}
+		queries[i] = nq
+	}
+	results := make([]ExistsResult, len(queries))
+	sem := make(chan struct{}, batchConcurrency)
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = s.lookup(r.Context(), q)
+		}()
+	}
+	wg.Wait()
+	writeJSON(w, http.StatusOK, batchResponse{Results: results})
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleReady(w http.ResponseWriter, _ *http.Request) {
+	if !s.ready.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,317 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer returns a server backed by a mock registry serving the given
+// tags of hsn723/public-hoge, and a counter of clients created.
+func newTestServer(t *testing.T, tags []string, positiveTTL, negativeTTL time.Duration) (*httptest.Server, string, *int32) {
+	t.Helper()
+	registry := mockRegistry{
+		t:         t,
+		scope:     "repository:hsn723/public-hoge:pull",
+		bearer:    "aG9nZWJlYXJlcg==",
+		tags:      tags,
+		manifest:  sampleManifest,
+		anonymous: true,
+	}
+	registry.init()
+	registryURL := registry.server.Listener.Addr().String()
+	var clients int32
+	s := NewServer(func(image string) (*RegistryClient, error) {
+		atomic.AddInt32(&clients, 1)
+		u, err := ExtractRegistryURL(image)
+		if err != nil {
+			return nil, err
+		}
+		path, err := ExtractImagePath(image)
+		if err != nil {
+			return nil, err
+		}
+		return &RegistryClient{
+			RegistryName: NormalizeRegistryName(u),
+			RegistryURL:  u,
+			ImagePath:    path,
+			HttpClient:   http.DefaultClient,
+		}, nil
+	}, positiveTTL, negativeTTL)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return ts, registryURL, &clients
+}
+
+func TestServerExists(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title          string
+		query          func(registry string) url.Values
+		expectStatus   int
+		expectFound    bool
+		expectErr      bool
+		expectPlatform []string
+	}{
+		{
+			title: "Found",
+			query: func(registry string) url.Values {
+				return url.Values{"ref": {registry + "/hsn723/public-hoge:1.0.0"}}
+			},
+			expectStatus: http.StatusOK,
+			expectFound:  true,
+		},
+		{
+			title: "NotFound",
+			query: func(registry string) url.Values {
+				return url.Values{"ref": {registry + "/hsn723/public-hoge:3.0.0"}}
+			},
+			expectStatus: http.StatusOK,
+		},
+		{
+			title: "Platforms",
+			query: func(registry string) url.Values {
+				return url.Values{
+					"ref":      {registry + "/hsn723/public-hoge:1.0.0"},
+					"platform": {"linux/arm64,linux/amd64", "linux/amd64"},
+				}
+			},
+			expectStatus:   http.StatusOK,
+			expectFound:    true,
+			expectPlatform: []string{"linux/amd64", "linux/arm64"},
+		},
+		{
+			title: "MissingRef",
+			query: func(string) url.Values {
+				return url.Values{}
+			},
+			expectStatus: http.StatusBadRequest,
+			expectErr:    true,
+		},
+		{
+			title: "MissingTag",
+			query: func(registry string) url.Values {
+				return url.Values{"ref": {registry + "/hsn723/public-hoge"}}
+			},
+			expectStatus: http.StatusBadRequest,
+			expectErr:    true,
+		},
+		{
+			title: "MissingRegistry",
+			query: func(string) url.Values {
+				return url.Values{"ref": {"alpine:3"}}
+			},
+			expectStatus: http.StatusBadRequest,
+			expectErr:    true,
+		},
+		{
+			title: "Unreachable",
+			query: func(string) url.Values {
+				return url.Values{"ref": {"127.0.0.1:1/hsn723/hoge:1.0.0"}}
+			},
+			expectStatus: http.StatusBadGateway,
+			expectErr:    true,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			ts, registry, _ := newTestServer(t, []string{"1.0.0", "2.0.0"}, time.Minute, time.Minute)
+			resp, err := http.Get(fmt.Sprintf("%s/v1/exists?%s", ts.URL, c.query(registry).Encode()))
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+			assert.Equal(t, c.expectStatus, resp.StatusCode)
+			assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+			var res ExistsResult
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+			assert.Equal(t, c.expectFound, res.Found)
+			assert.Equal(t, c.expectErr, res.Error != "")
+			assert.Equal(t, c.expectPlatform, res.Platforms)
+		})
+	}
+}
+
+func TestServerCache(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title         string
+		tag           string
+		positiveTTL   time.Duration
+		negativeTTL   time.Duration
+		expectCached  bool
+		expectClients int32
+	}{
+		{title: "Positive", tag: "1.0.0", positiveTTL: time.Minute, expectCached: true, expectClients: 1},
+		{title: "PositiveDisabled", tag: "1.0.0", negativeTTL: time.Minute, expectClients: 2},
+		{title: "Negative", tag: "3.0.0", negativeTTL: time.Minute, expectCached: true, expectClients: 1},
+		{title: "NegativeDisabled", tag: "3.0.0", positiveTTL: time.Minute, expectClients: 2},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			ts, registry, clients := newTestServer(t, []string{"1.0.0"}, c.positiveTTL, c.negativeTTL)
+			endpoint := fmt.Sprintf("%s/v1/exists?ref=%s/hsn723/public-hoge:%s", ts.URL, registry, c.tag)
+			var res ExistsResult
+			for i := 0; i < 2; i++ {
+				resp, err := http.Get(endpoint)
+				if !assert.NoError(t, err) {
+					return
+				}
+				res = ExistsResult{}
+				assert.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+				resp.Body.Close()
+			}
+			assert.Equal(t, c.expectCached, res.Cached)
+			assert.Equal(t, c.expectClients, atomic.LoadInt32(clients))
+		})
+	}
+}
+
+func TestResultCacheExpiry(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(0, 0)
+	c := &resultCache{
+		results:     make(map[string]cachedResult),
+		positiveTTL: time.Minute,
+		negativeTTL: time.Second,
+		now:         func() time.Time { return now },
+	}
+	found := ExistsQuery{Ref: "example.com/hoge:1.0.0"}
+	missing := ExistsQuery{Ref: "example.com/hoge:2.0.0"}
+	c.put(found, ExistsResult{Ref: found.Ref, Found: true})
+	c.put(missing, ExistsResult{Ref: missing.Ref})
+
+	now = now.Add(2 * time.Second)
+	_, ok := c.get(missing)
+	assert.False(t, ok)
+	res, ok := c.get(found)
+	assert.True(t, ok)
+	assert.True(t, res.Found)
+
+	now = now.Add(time.Minute)
+	_, ok = c.get(found)
+	assert.False(t, ok)
+	assert.Empty(t, c.results)
+}
+
+func TestServerBatch(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title        string
+		body         func(registry string) string
+		expectStatus int
+		expectFound  []bool
+	}{
+		{
+			title: "Batch",
+			body: func(registry string) string {
+				return fmt.Sprintf(`{"refs":[{"ref":"%[1]s/hsn723/public-hoge:1.0.0"},{"ref":"%[1]s/hsn723/public-hoge:3.0.0"},{"ref":"%[1]s/hsn723/public-hoge:2.0.0","platforms":["linux/amd64"]}]}`, registry)
+			},
+			expectStatus: http.StatusOK,
+			expectFound:  []bool{true, false, true},
+		},
+		{
+			title: "Empty",
+			body: func(string) string {
+				return `{"refs":[]}`
+			},
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			title: "Malformed",
+			body: func(string) string {
+				return `{"refs":`
+			},
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			title: "UnknownField",
+			body: func(string) string {
+				return `{"images":[]}`
+			},
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			title: "InvalidRef",
+			body: func(registry string) string {
+				return fmt.Sprintf(`{"refs":[{"ref":"%s/hsn723/public-hoge"}]}`, registry)
+			},
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			title: "MissingRegistry",
+			body: func(string) string {
+				return `{"refs":[{"ref":"alpine:3"}]}`
+			},
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			title: "TooMany",
+			body: func(registry string) string {
+				refs := make([]string, MaxBatchSize+1)
+				for i := range refs {
+					refs[i] = fmt.Sprintf(`{"ref":"%s/hsn723/public-hoge:1.0.0"}`, registry)
+				}
+				return fmt.Sprintf(`{"refs":[%s]}`, strings.Join(refs, ","))
+			},
+			expectStatus: http.StatusBadRequest,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			ts, registry, _ := newTestServer(t, []string{"1.0.0", "2.0.0"}, time.Minute, time.Minute)
+			resp, err := http.Post(ts.URL+"/v1/exists", "application/json", strings.NewReader(c.body(registry)))
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+			assert.Equal(t, c.expectStatus, resp.StatusCode)
+			if c.expectStatus != http.StatusOK {
+				return
+			}
+			var res batchResponse
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+			found := make([]bool, len(res.Results))
+			for i, r := range res.Results {
+				assert.Empty(t, r.Error)
+				found[i] = r.Found
+			}
+			assert.Equal(t, c.expectFound, found)
+		})
+	}
+}
+
+func TestServerHealth(t *testing.T) {
+	t.Parallel()
+	s := NewServer(nil, 0, 0)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	status := func(path string) int {
+		resp, err := http.Get(ts.URL + path)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, status("/healthz"))
+	assert.Equal(t, http.StatusServiceUnavailable, status("/readyz"))
+	s.SetReady(true)
+	assert.Equal(t, http.StatusOK, status("/readyz"))
+	s.SetReady(false)
+	assert.Equal(t, http.StatusServiceUnavailable, status("/readyz"))
+}
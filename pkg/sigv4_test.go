@@ -0,0 +1,106 @@
+package pkg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignV4(t *testing.T) {
+	t.Parallel()
+	// Example from the AWS Signature Version 4 documentation.
+	creds := awsCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	headers := map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded; charset=utf-8",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	actual, err := signV4("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", headers, nil, creds, "us-east-1", "iam", now)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"Content-Type":  "application/x-www-form-urlencoded; charset=utf-8",
+		"X-Amz-Date":    "20150830T123600Z",
+		"Authorization": "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+	}, actual)
+}
+
+func TestLoadAWSCredentials(t *testing.T) {
+	credentialsFile := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(credentialsFile, []byte(`[default]
+aws_access_key_id = AKIDDEFAULT
+aws_secret_access_key = defaultsecret
+
+# comment
+[hoge]
+aws_access_key_id = AKIDHOGE
+aws_secret_access_key = hogesecret
+aws_session_token = hogesession
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		title    string
+		env      map[string]string
+		expect   awsCredentials
+		isErr    bool
+		notFound bool
+	}{
+		{
+			title: "Env",
+			env: map[string]string{
+				"AWS_ACCESS_KEY_ID":     "AKIDENV",
+				"AWS_SECRET_ACCESS_KEY": "envsecret",
+				"AWS_SESSION_TOKEN":     "envsession",
+			},
+			expect: awsCredentials{AccessKeyID: "AKIDENV", SecretAccessKey: "envsecret", SessionToken: "envsession"},
+		},
+		{
+			title:  "DefaultProfile",
+			expect: awsCredentials{AccessKeyID: "AKIDDEFAULT", SecretAccessKey: "defaultsecret"},
+		},
+		{
+			title:  "Profile",
+			env:    map[string]string{"AWS_PROFILE": "hoge"},
+			expect: awsCredentials{AccessKeyID: "AKIDHOGE", SecretAccessKey: "hogesecret", SessionToken: "hogesession"},
+		},
+		{
+			title: "MissingProfile",
+			env:   map[string]string{"AWS_PROFILE": "hige"},
+			isErr: true,
+		},
+		{
+			title:    "NoDefaultFile",
+			env:      map[string]string{"AWS_SHARED_CREDENTIALS_FILE": "", "HOME": "/nonexistent"},
+			isErr:    true,
+			notFound: true,
+		},
+		{
+			title: "MissingFile",
+			env:   map[string]string{"AWS_SHARED_CREDENTIALS_FILE": "/nonexistent/credentials"},
+			isErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			t.Helper()
+			t.Setenv("AWS_ACCESS_KEY_ID", "")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+			t.Setenv("AWS_SESSION_TOKEN", "")
+			t.Setenv("AWS_PROFILE", "")
+			t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+			for k, v := range c.env {
+				t.Setenv(k, v)
+			}
+			actual, err := loadAWSCredentials()
+			assertExpectedErr(t, err, c.isErr)
+			assert.Equal(t, c.notFound, errors.Is(err, ErrCredentialsNotFound))
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
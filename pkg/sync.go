@@ -0,0 +1,252 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	tagsListAPI     = "%s/v2/%s/tags/list"
+	linkNextPattern = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+	// errTokenRejected is returned when a token is rejected while resolving
+	// digests, for instance because it expired.
+	errTokenRejected = errors.New("token rejected")
+)
+
+type tagsListResponse struct {
+	Tags []string `json:"tags"`
+}
+
+// TagMismatch describes a tag that points to different digests in the source
+// and destination repositories.
+type TagMismatch struct {
+	Tag               string `json:"tag"`
+	SourceDigest      string `json:"sourceDigest"`
+	DestinationDigest string `json:"destinationDigest"`
+}
+
+// SyncReport describes the drift between a source repository and one of its
+// destination repositories.
+type SyncReport struct {
+	Destination string        `json:"destination"`
+	Missing     []string      `json:"missing"`
+	Mismatched  []TagMismatch `json:"mismatched"`
+	Extra       []string      `json:"extra"`
+}
+
+// HasDrift returns true if the destination is not in sync with the source.
+func (s SyncReport) HasDrift() bool {
+	return len(s.Missing) > 0 || len(s.Mismatched) > 0 || len(s.Extra) > 0
+}
+
+func (r RegistryClient) listTagsPage(bearer, endpoint string) ([]string, string, error) {
+	headers := map[string]string{
+		"Accept": "application/json",
+	}
+	if bearer != "" {
+		headers["Authorization"] = authorizationHeader(bearer)
+	}
+	status, header, res, err := r.retrieveWithHeader(http.MethodGet, endpoint, headers)
+	if err != nil {
+		return nil, "", err
+	}
+	if status != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected response registry API: %d", status)
+	}
+	var tags tagsListResponse
+	if err := json.Unmarshal(res, &tags); err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if m := linkNextPattern.FindStringSubmatch(header.Get("Link")); m != nil {
+		next, err = resolveLink(endpoint, m[1])
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return tags.Tags, next, nil
+}
+
+// resolveLink resolves the URL of a Link header, which may be absolute or
+// relative, against the URL of the request it was sent for.
+func resolveLink(endpoint, link string) (string, error) {
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("malformed Link header URL %q: %w", link, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+func (r RegistryClient) listTags(bearer string) ([]string, error) {
+	var tags []string
+	endpoint := fmt.Sprintf(tagsListAPI, r.baseURL(), r.ImagePath)
+	for endpoint != "" {
+		page, next, err := r.listTagsPage(bearer, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, page...)
+		endpoint = next
+	}
+	return tags, nil
+}
+
+// ListTags returns all tags in the repository, following pagination.
+// Mirrors are not consulted.
+func (r RegistryClient) ListTags() ([]string, error) {
+	r.Mirrors = nil
+	tags, _, err := r.listTagsWithAuth()
+	return tags, err
+}
+
+// listTagsWithAuth lists tags like ListTags, and also returns the token they
+// were listed with, which grants pull access to the repository.
+func (r RegistryClient) listTagsWithAuth() ([]string, string, error) {
+	var tags []string
+	var token string
+	err := r.withAuth(func(bearer string) error {
+		var err error
+		tags, err = r.listTags(bearer)
+		token = bearer
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return tags, token, nil
+}
+
+// headDigest returns the digest of the manifest of the tag from the
+// Docker-Content-Digest header of a HEAD request, which Docker Hub does not
+// count as a pull. Registries that do not send the header are sent a GET
+// request instead.
+func (r RegistryClient) headDigest(bearer, tag string) (string, error) {
+	endpoint := fmt.Sprintf(manifestAPI, r.baseURL(), r.ImagePath, tag)
+	headers := map[string]string{
+		"Accept": strings.Join(manifestAcceptTypes, ", "),
+	}
+	if bearer != "" {
+		headers["Authorization"] = authorizationHeader(bearer)
+	}
+	status, header, _, err := r.retrieveWithHeader(http.MethodHead, endpoint, headers)
+	if err != nil {
+		return "", err
+	}
+	switch status {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", fmt.Errorf("%s:%s not found", r.ImagePath, tag)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "", fmt.Errorf("%w: %d", errTokenRejected, status)
+	default:
+		return "", fmt.Errorf("unexpected response registry API: %d", status)
+	}
+	if digest := header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	header, res, err := r.fetchManifest(bearer, tag)
+	if err != nil {
+		return "", err
+	}
+	digests, err := parseImageDigests(header, res)
+	return digests.Digest, err
+}
+
+// tagDigest returns the digest of the manifest of the tag, with the token
+// the tags were listed with, authenticating again only if it is rejected.
+func (r RegistryClient) tagDigest(bearer, tag string) (string, error) {
+	digest, err := r.headDigest(bearer, tag)
+	if !errors.Is(err, errTokenRejected) {
+		return digest, err
+	}
+	err = r.withAuth(func(bearer string) error {
+		var err error
+		digest, err = r.headDigest(bearer, tag)
+		return err
+	})
+	return digest, err
+}
+
+// CheckSync lists the tags of the source repository and of each destination
+// repository, and reports tags missing on destinations, tags whose digests
+// differ, and tags present only on destinations. Mirrors are not consulted.
+func CheckSync(src RegistryClient, dsts []RegistryClient) ([]SyncReport, error) {
+	src.Mirrors = nil
+	srcTags, srcToken, err := src.listTagsWithAuth()
+	if err != nil {
+		return nil, err
+	}
+	srcDigests := make(map[string]string, len(srcTags))
+	reports := make([]SyncReport, 0, len(dsts))
+	for _, dst := range dsts {
+		dst.Mirrors = nil
+		report, err := checkSync(src, dst, srcTags, srcToken, srcDigests)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func checkSync(src, dst RegistryClient, srcTags []string, srcToken string, srcDigests map[string]string) (SyncReport, error) {
+	report := SyncReport{
+		Destination: fmt.Sprintf("%s/%s", dst.RegistryURL, dst.ImagePath),
+		Missing:     []string{},
+		Mismatched:  []TagMismatch{},
+		Extra:       []string{},
+	}
+	dstTags, dstToken, err := dst.listTagsWithAuth()
+	if err != nil {
+		return report, err
+	}
+	dstTagSet := make(map[string]bool, len(dstTags))
+	for _, t := range dstTags {
+		dstTagSet[t] = true
+	}
+	srcTagSet := make(map[string]bool, len(srcTags))
+	for _, t := range srcTags {
+		srcTagSet[t] = true
+		if !dstTagSet[t] {
+			report.Missing = append(report.Missing, t)
+			continue
+		}
+		srcDigest, ok := srcDigests[t]
+		if !ok {
+			srcDigest, err = src.tagDigest(srcToken, t)
+			if err != nil {
+				return report, err
+			}
+			srcDigests[t] = srcDigest
+		}
+		dstDigest, err := dst.tagDigest(dstToken, t)
+		if err != nil {
+			return report, err
+		}
+		if srcDigest != dstDigest {
+			report.Mismatched = append(report.Mismatched, TagMismatch{Tag: t, SourceDigest: srcDigest, DestinationDigest: dstDigest})
+		}
+	}
+	for _, t := range dstTags {
+		if !srcTagSet[t] {
+			report.Extra = append(report.Extra, t)
+		}
+	}
+	sort.Strings(report.Missing)
+	sort.Strings(report.Extra)
+	sort.Slice(report.Mismatched, func(i, j int) bool {
+		return report.Mismatched[i].Tag < report.Mismatched[j].Tag
+	})
+	return report, nil
+}
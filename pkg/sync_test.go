@@ -0,0 +1,210 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListTags(t *testing.T) {
+	cases := []struct {
+		title     string
+		bearerEnv string
+		path      string
+		registry  mockRegistry
+		expect    []string
+		isErr     bool
+	}{
+		{
+			title: "PublicImage",
+			path:  "hsn723/public-hoge",
+			registry: mockRegistry{
+				t:    t,
+				tags: []string{"1.0.0", "1.0.1", "0.1.0"},
+			},
+			expect: []string{"1.0.0", "1.0.1", "0.1.0"},
+		},
+		{
+			title:     "Paginated",
+			bearerEnv: "aG9nZWJlYXJlcg==",
+			path:      "hsn723/hoge",
+			registry: mockRegistry{
+				t:        t,
+				bearer:   "aG9nZWJlYXJlcg==",
+				tags:     []string{"1.0.0", "1.0.1", "0.1.0", "0.2.0", "0.3.0"},
+				pageSize: 2,
+			},
+			expect: []string{"1.0.0", "1.0.1", "0.1.0", "0.2.0", "0.3.0"},
+		},
+		{
+			title: "PaginatedAbsoluteLink",
+			path:  "hsn723/public-hoge",
+			registry: mockRegistry{
+				t:            t,
+				tags:         []string{"1.0.0", "1.0.1", "0.1.0"},
+				pageSize:     2,
+				absoluteLink: true,
+			},
+			expect: []string{"1.0.0", "1.0.1", "0.1.0"},
+		},
+		{
+			title: "Unauthorized",
+			path:  "hsn723/hoge",
+			registry: mockRegistry{
+				t:      t,
+				bearer: "aG9nZWJlYXJlcg==",
+				tags:   []string{"1.0.0"},
+			},
+			isErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			t.Helper()
+			c.registry.init()
+			url := c.registry.server.Listener.Addr().String()
+			client := RegistryClient{
+				RegistryName: NormalizeRegistryName(url),
+				RegistryURL:  url,
+				ImagePath:    c.path,
+				HttpClient:   http.DefaultClient,
+			}
+			t.Setenv(fmt.Sprintf("%s_TOKEN", client.RegistryName), c.bearerEnv)
+			actual, err := client.ListTags()
+			assertExpectedErr(t, err, c.isErr)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
+
+func TestResolveLink(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title    string
+		endpoint string
+		link     string
+		expect   string
+	}{
+		{
+			title:    "Relative",
+			endpoint: "https://ghcr.io/v2/hsn723/hoge/tags/list",
+			link:     "/v2/hsn723/hoge/tags/list?n=2&last=1.0.0",
+			expect:   "https://ghcr.io/v2/hsn723/hoge/tags/list?n=2&last=1.0.0",
+		},
+		{
+			title:    "Absolute",
+			endpoint: "https://ghcr.io/v2/hsn723/hoge/tags/list",
+			link:     "https://pkg-containers.example.com/v2/hsn723/hoge/tags/list?last=1.0.0",
+			expect:   "https://pkg-containers.example.com/v2/hsn723/hoge/tags/list?last=1.0.0",
+		},
+		{
+			title:    "PathPrefix",
+			endpoint: "https://artifactory.example.com/artifactory/api/docker/docker-remote/v2/hsn723/hoge/tags/list",
+			link:     "/artifactory/api/docker/docker-remote/v2/hsn723/hoge/tags/list?last=1.0.0",
+			expect:   "https://artifactory.example.com/artifactory/api/docker/docker-remote/v2/hsn723/hoge/tags/list?last=1.0.0",
+		},
+		{
+			title:    "RelativePath",
+			endpoint: "https://registry.example.com/prefix/v2/hsn723/hoge/tags/list?n=2",
+			link:     "list?n=2&last=1.0.0",
+			expect:   "https://registry.example.com/prefix/v2/hsn723/hoge/tags/list?n=2&last=1.0.0",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			actual, err := resolveLink(c.endpoint, c.link)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}
+
+func TestCheckSync(t *testing.T) {
+	cases := []struct {
+		title  string
+		src    mockRegistry
+		dst    mockRegistry
+		expect SyncReport
+		drift  bool
+	}{
+		{
+			title:  "InSync",
+			src:    mockRegistry{t: t, tags: []string{"1.0.0", "1.0.1"}, manifest: sampleManifest},
+			dst:    mockRegistry{t: t, tags: []string{"1.0.1", "1.0.0"}, manifest: sampleManifest},
+			expect: SyncReport{Missing: []string{}, Mismatched: []TagMismatch{}, Extra: []string{}},
+		},
+		{
+			title: "Drift",
+			src:   mockRegistry{t: t, tags: []string{"1.0.0", "1.0.1", "1.0.2"}, manifest: sampleManifest},
+			dst:   mockRegistry{t: t, tags: []string{"1.0.1", "1.0.2", "1.0.3"}, manifest: []byte(`{}`)},
+			expect: SyncReport{
+				Missing: []string{"1.0.0"},
+				Mismatched: []TagMismatch{
+					{Tag: "1.0.1", SourceDigest: "sha256:58b773b2f888498289db35ece6d1db28df010d452671378fd47fc3e1ff0a6981", DestinationDigest: "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"},
+					{Tag: "1.0.2", SourceDigest: "sha256:58b773b2f888498289db35ece6d1db28df010d452671378fd47fc3e1ff0a6981", DestinationDigest: "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"},
+				},
+				Extra: []string{"1.0.3"},
+			},
+			drift: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			t.Helper()
+			c.src.init()
+			c.dst.init()
+			newClient := func(m mockRegistry) RegistryClient {
+				url := m.server.Listener.Addr().String()
+				return RegistryClient{
+					RegistryName: NormalizeRegistryName(url),
+					RegistryURL:  url,
+					ImagePath:    "hsn723/public-hoge",
+					HttpClient:   http.DefaultClient,
+				}
+			}
+			dst := newClient(c.dst)
+			c.expect.Destination = fmt.Sprintf("%s/%s", dst.RegistryURL, dst.ImagePath)
+			actual, err := CheckSync(newClient(c.src), []RegistryClient{dst})
+			assert.NoError(t, err)
+			assert.Equal(t, []SyncReport{c.expect}, actual)
+			assert.Equal(t, c.drift, actual[0].HasDrift())
+		})
+	}
+}
+
+func TestCheckSyncRequests(t *testing.T) {
+	newRegistry := func() *mockRegistry {
+		m := &mockRegistry{
+			t:         t,
+			scope:     "repository:hsn723/hoge:pull",
+			bearer:    "aG9nZWJlYXJlcg==",
+			tags:      []string{"1.0.0", "1.0.1", "1.0.2"},
+			manifest:  sampleManifest,
+			anonymous: true,
+		}
+		m.init()
+		return m
+	}
+	newClient := func(m *mockRegistry) RegistryClient {
+		url := m.server.Listener.Addr().String()
+		return RegistryClient{
+			RegistryName: NormalizeRegistryName(url),
+			RegistryURL:  url,
+			ImagePath:    "hsn723/hoge",
+			HttpClient:   http.DefaultClient,
+		}
+	}
+	src, dst := newRegistry(), newRegistry()
+	actual, err := CheckSync(newClient(src), []RegistryClient{newClient(dst)})
+	assert.NoError(t, err)
+	assert.False(t, actual[0].HasDrift())
+	for _, m := range []*mockRegistry{src, dst} {
+		assert.Equal(t, int32(1), atomic.LoadInt32(&m.tokenRequests))
+		assert.Equal(t, int32(0), atomic.LoadInt32(&m.manifestGets))
+	}
+}
@@ -0,0 +1,89 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	tracerName = "github.com/Hsn723/container-tag-exists/pkg"
+
+	// Authentication methods recorded in spans.
+	authMethodAnonymous      = "anonymous"
+	authMethodAnonymousToken = "anonymous_token"
+	authMethodCredentials    = "credentials"
+)
+
+var (
+	attrRegistry   = attribute.Key("registry.host")
+	attrRepository = attribute.Key("registry.repository")
+	attrTag        = attribute.Key("registry.tag")
+	attrFound      = attribute.Key("registry.tag.found")
+	attrEndpoint   = attribute.Key("registry.endpoint")
+	attrAuthMethod = attribute.Key("registry.auth.method")
+	attrAuthScheme = attribute.Key("registry.auth.scheme")
+)
+
+func (r RegistryClient) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// withContext returns a copy of the client whose requests are made with ctx,
+// so that their spans are children of the span in ctx.
+func (r RegistryClient) withContext(ctx context.Context) RegistryClient {
+	r.ctx = ctx
+	return r
+}
+
+func (r RegistryClient) tracer() trace.Tracer {
+	tp := r.TracerProvider
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// setAuthMethod records on the current span how the registry was accessed.
+func (r RegistryClient) setAuthMethod(method string) {
+	trace.SpanFromContext(r.context()).SetAttributes(attrAuthMethod.String(method))
+}
+
+// startRequestSpan starts the span of an HTTP request sent by the client.
+func (r RegistryClient) startRequestSpan(req *http.Request, attempt int) (*http.Request, trace.Span) {
+	scheme := "none"
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		scheme, _, _ = strings.Cut(auth, " ")
+		scheme = strings.ToLower(scheme)
+	}
+	ctx, span := r.tracer().Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.String()),
+			attribute.String("server.address", req.URL.Host),
+			attribute.Int("http.request.resend_count", attempt-1),
+			attrRegistry.String(r.RegistryURL),
+			attrRepository.String(r.ImagePath),
+			attrAuthScheme.String(scheme),
+		),
+	)
+	return req.WithContext(ctx), span
+}
+
+// endSpan records the error, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestIsTagExistSpans(t *testing.T) {
+	t.Parallel()
+	registry := mockRegistry{
+		t:         t,
+		scope:     "repository:hsn723/hoge:pull",
+		bearer:    "aG9nZWJlYXJlcg==",
+		tags:      []string{"1.0.0"},
+		anonymous: true,
+	}
+	registry.init()
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	url := registry.server.Listener.Addr().String()
+	client := RegistryClient{
+		RegistryName:   NormalizeRegistryName(url),
+		RegistryURL:    url,
+		ImagePath:      "hsn723/hoge",
+		HttpClient:     http.DefaultClient,
+		TracerProvider: tp,
+	}
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "test")
+	found, err := client.IsTagExistContext(ctx, "1.0.0")
+	parent.End()
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	spans := recorder.Ended()
+	var check sdktrace.ReadOnlySpan
+	var requests []sdktrace.ReadOnlySpan
+	for _, s := range spans {
+		switch s.Name() {
+		case "IsTagExist":
+			check = s
+		case "test":
+		default:
+			requests = append(requests, s)
+		}
+	}
+	if check == nil {
+		t.Fatal("no IsTagExist span")
+	}
+	assert.Equal(t, parent.SpanContext().SpanID(), check.Parent().SpanID())
+	attrs := spanAttributes(check)
+	assert.Equal(t, url, attrs[attrRegistry].AsString())
+	assert.Equal(t, "hsn723/hoge", attrs[attrRepository].AsString())
+	assert.Equal(t, "1.0.0", attrs[attrTag].AsString())
+	assert.True(t, attrs[attrFound].AsBool())
+	assert.Equal(t, authMethodAnonymousToken, attrs[attrAuthMethod].AsString())
+
+	// The anonymous attempt, the challenge, the token and the authenticated
+	// attempt.
+	assert.Len(t, requests, 4)
+	for _, s := range requests {
+		assert.Equal(t, check.SpanContext().SpanID(), s.Parent().SpanID())
+		assert.Equal(t, check.SpanContext().TraceID(), s.SpanContext().TraceID())
+	}
+	last := spanAttributes(requests[len(requests)-1])
+	assert.Equal(t, "HTTP HEAD", requests[len(requests)-1].Name())
+	assert.Equal(t, int64(http.StatusOK), last["http.response.status_code"].AsInt64())
+	assert.Equal(t, "bearer", last[attrAuthScheme].AsString())
+	assert.Equal(t, int64(0), last["http.request.resend_count"].AsInt64())
+}
@@ -0,0 +1,178 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTokenLifetime is the lifetime assumed for tokens that do not
+	// specify expires_in, as per the token authentication specification.
+	defaultTokenLifetime = 60 * time.Second
+	// tokenExpiryMargin is subtracted from token lifetimes so that tokens are
+	// not used right before they expire.
+	tokenExpiryMargin = 5 * time.Second
+)
+
+// TokenCache holds bearer tokens until they expire, keyed by registry, scope
+// and credentials. It is safe for concurrent use.
+type TokenCache struct {
+	mu     sync.Mutex
+	path   string
+	tokens map[string]cachedToken
+}
+
+type cachedToken struct {
+	Token  string    `json:"token"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// NewTokenCache returns an in-memory token cache.
+func NewTokenCache() *TokenCache {
+	return &TokenCache{tokens: make(map[string]cachedToken)}
+}
+
+// NewFileTokenCache returns a token cache persisted to the file at path, so
+// that tokens can be reused across processes. Valid tokens already in the file
+// are loaded.
+func NewFileTokenCache(path string) (*TokenCache, error) {
+	c := NewTokenCache()
+	c.path = path
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c.tokens); err != nil {
+		return nil, fmt.Errorf("failed to read token cache %s: %w", path, err)
+	}
+	now := time.Now()
+	for k, t := range c.tokens {
+		if !now.Before(t.Expiry) {
+			delete(c.tokens, k)
+		}
+	}
+	return c, nil
+}
+
+// DefaultTokenCachePath returns the path of the token cache file under
+// $XDG_CACHE_HOME, or ~/.cache if unset.
+func DefaultTokenCachePath() (string, error) {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(dir, "container-tag-exists", "tokens.json"), nil
+}
+
+func (c *TokenCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tokens[key]
+	if !ok || !time.Now().Before(t.Expiry) {
+		return "", false
+	}
+	return t.Token, true
+}
+
+func (c *TokenCache) put(key string, token tokenResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[key] = cachedToken{Token: token.bearer(), Expiry: token.expiry()}
+	if c.path == "" {
+		return nil
+	}
+	return c.save()
+}
+
+// save writes the cache to its file, readable only by the current user.
+func (c *TokenCache) save() error {
+	b, err := json.Marshal(c.tokens)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	// Temporary files are created with 0600 permissions.
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".tokens-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// tokenCacheKey returns the key of tokens obtained with the given identity.
+// Keys of tokens obtained with credentials include a digest of the
+// credentials, so that tokens are not reused once credentials change or are
+// removed, including by later processes sharing the cache file.
+func (r RegistryClient) tokenCacheKey(identity string) string {
+	if identity == anonymousIdentity {
+		return fmt.Sprintf("%s %s %s", r.RegistryURL, r.scope(), identity)
+	}
+	return fmt.Sprintf("%s %s %s %s", r.RegistryURL, r.scope(), identity, r.credentialDigest())
+}
+
+// credentialDigest returns the SHA-256 digest of the credentials available
+// for the registry from the environment, credential files, the pull secret,
+// the docker configuration, CI platforms and cloud providers.
+func (r RegistryClient) credentialDigest() string {
+	h := sha256.New()
+	write := func(v string) {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	for _, prefix := range r.envPrefixes() {
+		for _, suffix := range credentialSuffixes {
+			write(envValue(fmt.Sprintf("%s_%s", prefix, suffix)))
+		}
+	}
+	write(r.getRefreshToken())
+	if auth, ok := r.pullSecretAuth(); ok {
+		write(auth.authToken())
+	}
+	for _, name := range append(r.ciEnvNames(), r.providerEnvNames()...) {
+		write(os.Getenv(name))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachedToken returns a valid cached token obtained with the given identity,
+// either anonymous or the name credentials were looked up with.
+func (r RegistryClient) cachedToken(identity string) string {
+	if r.TokenCache == nil {
+		return ""
+	}
+	token, _ := r.TokenCache.get(r.tokenCacheKey(identity))
+	return token
+}
+
+func (r RegistryClient) cacheToken(identity string, token tokenResponse) {
+	if r.TokenCache == nil || token.bearer() == "" {
+		return
+	}
+	// Failing to persist the cache only means tokens are fetched again.
+	_ = r.TokenCache.put(r.tokenCacheKey(identity), token)
+}
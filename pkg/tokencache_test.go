@@ -0,0 +1,153 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenResponseExpiry(t *testing.T) {
+	t.Parallel()
+	issuedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		title  string
+		token  tokenResponse
+		expect time.Time
+	}{
+		{
+			title:  "ExpiresIn",
+			token:  tokenResponse{ExpiresIn: 300, IssuedAt: issuedAt.Format(time.RFC3339)},
+			expect: issuedAt.Add(300*time.Second - tokenExpiryMargin),
+		},
+		{
+			title:  "DefaultLifetime",
+			token:  tokenResponse{IssuedAt: issuedAt.Format(time.RFC3339)},
+			expect: issuedAt.Add(defaultTokenLifetime - tokenExpiryMargin),
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, c.expect, c.token.expiry())
+		})
+	}
+}
+
+func TestTokenCache(t *testing.T) {
+	t.Parallel()
+	c := NewTokenCache()
+	assert.NoError(t, c.put("valid", tokenResponse{Token: "hoge", ExpiresIn: 300}))
+	assert.NoError(t, c.put("expired", tokenResponse{Token: "hige", ExpiresIn: 300, IssuedAt: "2024-01-01T00:00:00Z"}))
+	token, ok := c.get("valid")
+	assert.True(t, ok)
+	assert.Equal(t, "hoge", token)
+	_, ok = c.get("expired")
+	assert.False(t, ok)
+	_, ok = c.get("missing")
+	assert.False(t, ok)
+}
+
+func TestFileTokenCache(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "container-tag-exists", "tokens.json")
+	c, err := NewFileTokenCache(path)
+	assert.NoError(t, err)
+	assert.NoError(t, c.put("valid", tokenResponse{Token: "hoge", ExpiresIn: 300}))
+	assert.NoError(t, c.put("expired", tokenResponse{Token: "hige", ExpiresIn: 300, IssuedAt: "2024-01-01T00:00:00Z"}))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	reloaded, err := NewFileTokenCache(path)
+	assert.NoError(t, err)
+	assert.Len(t, reloaded.tokens, 1)
+	token, ok := reloaded.get("valid")
+	assert.True(t, ok)
+	assert.Equal(t, "hoge", token)
+}
+
+func TestCachedBearerToken(t *testing.T) {
+	registry := mockRegistry{
+		t:      t,
+		scope:  "repository:hsn723/hoge:pull",
+		basic:  "aG9nZTpoaWdl",
+		bearer: "aG9nZWJlYXJlcg==",
+		tags:   []string{"1.0.0"},
+	}
+	registry.init()
+	url := registry.server.Listener.Addr().String()
+	client := RegistryClient{
+		RegistryName: NormalizeRegistryName(url),
+		RegistryURL:  url,
+		ImagePath:    "hsn723/hoge",
+		HttpClient:   http.DefaultClient,
+		TokenCache:   NewTokenCache(),
+	}
+	t.Setenv(fmt.Sprintf("%s_AUTH", client.RegistryName), "aG9nZTpoaWdl")
+	for i := 0; i < 3; i++ {
+		found, err := client.IsTagExist("1.0.0")
+		assert.NoError(t, err)
+		assert.True(t, found)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&registry.tokenRequests))
+}
+
+func TestFileTokenCacheCredentialsChange(t *testing.T) {
+	registry := mockRegistry{
+		t:      t,
+		scope:  "repository:hsn723/hoge:pull",
+		basic:  "aG9nZTpoaWdl",
+		bearer: "aG9nZWJlYXJlcg==",
+		tags:   []string{"1.0.0"},
+	}
+	registry.init()
+	url := registry.server.Listener.Addr().String()
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	name := NormalizeRegistryName(url)
+	// A token cached for previous credentials would let the lookup succeed.
+	cases := []struct {
+		title        string
+		auth         string
+		expectErr    bool
+		expectCached bool
+	}{
+		{title: "FirstRun", auth: "aG9nZTpoaWdl"},
+		{title: "SameCredentials", auth: "aG9nZTpoaWdl", expectCached: true},
+		{title: "ChangedCredentials", auth: "aG9nZTpodWdh", expectErr: true},
+		{title: "RemovedCredentials", expectErr: true},
+	}
+	// Each case is a separate run sharing the cache file.
+	for _, c := range cases {
+		before := atomic.LoadInt32(&registry.tokenRequests)
+		t.Setenv(fmt.Sprintf("%s_AUTH", name), c.auth)
+		cache, err := NewFileTokenCache(path)
+		if !assert.NoError(t, err, c.title) {
+			return
+		}
+		client := RegistryClient{
+			RegistryName: name,
+			RegistryURL:  url,
+			ImagePath:    "hsn723/hoge",
+			HttpClient:   http.DefaultClient,
+			TokenCache:   cache,
+		}
+		found, err := client.IsTagExist("1.0.0")
+		if c.expectErr {
+			assert.Error(t, err, c.title)
+		} else {
+			assert.NoError(t, err, c.title)
+			assert.True(t, found, c.title)
+		}
+		if c.expectCached {
+			assert.Equal(t, before, atomic.LoadInt32(&registry.tokenRequests), c.title)
+		}
+	}
+}
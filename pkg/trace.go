@@ -0,0 +1,182 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const redacted = "REDACTED"
+
+var (
+	// secretHeaders lists headers whose values are redacted. For
+	// authorization headers, the scheme is kept.
+	secretHeaders = map[string]bool{
+		"Authorization":        true,
+		"Proxy-Authorization":  true,
+		"Cookie":               true,
+		"Set-Cookie":           true,
+		"X-Amz-Security-Token": true,
+	}
+	// secretFields lists form and JSON fields whose values are redacted in
+	// request and response bodies.
+	secretFields = map[string]bool{
+		"password":           true,
+		"refresh_token":      true,
+		"access_token":       true,
+		"token":              true,
+		"id_token":           true,
+		"client_secret":      true,
+		"assertion":          true,
+		"authorizationToken": true,
+	}
+	// tracedHeaders lists the response headers logged for each exchange.
+	tracedHeaders = []string{
+		"WWW-Authenticate",
+		"Docker-Content-Digest",
+		"Docker-Distribution-Api-Version",
+		"Content-Type",
+		"Location",
+		"Retry-After",
+		"RateLimit-Limit",
+		"RateLimit-Remaining",
+		"Docker-RateLimit-Source",
+	}
+)
+
+// redactHeaders returns a copy of the headers with secrets redacted.
+func redactHeaders(h http.Header) http.Header {
+	res := h.Clone()
+	for name, values := range res {
+		if !secretHeaders[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+		for i, v := range values {
+			scheme, _, found := strings.Cut(v, " ")
+			if found && strings.HasSuffix(http.CanonicalHeaderKey(name), "Authorization") {
+				values[i] = scheme + " " + redacted
+			} else {
+				values[i] = redacted
+			}
+		}
+	}
+	return res
+}
+
+// redactJSON redacts secret fields in a decoded JSON value.
+func redactJSON(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if _, ok := field.(string); ok && secretFields[k] {
+				v[k] = redacted
+				continue
+			}
+			redactJSON(field)
+		}
+	case []interface{}:
+		for _, item := range v {
+			redactJSON(item)
+		}
+	}
+}
+
+// redactBody returns a request or response body with secret form or JSON
+// fields redacted.
+func redactBody(contentType string, body []byte) string {
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return redacted
+		}
+		for k := range form {
+			if secretFields[k] {
+				form.Set(k, redacted)
+			}
+		}
+		return form.Encode()
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+	redactJSON(v)
+	b, err := json.Marshal(v)
+	if err != nil {
+		return redacted
+	}
+	return string(b)
+}
+
+// TracingTransport logs and records HTTP exchanges, with secrets redacted.
+type TracingTransport struct {
+	// Base is the transport performing requests, or http.DefaultTransport
+	// if nil.
+	Base http.RoundTripper
+	// Log, if set, is called with a summary of each exchange. Errors are
+	// ignored.
+	Log func(msg string, fields map[string]interface{}) error
+	// HAR, if set, records each exchange.
+	HAR *HAR
+}
+
+func (t *TracingTransport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *TracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if t.HAR != nil && req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err == nil {
+			reqBody, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+	started := time.Now()
+	res, err := t.base().RoundTrip(req)
+	elapsed := time.Since(started)
+	var resBody []byte
+	if err == nil && t.HAR != nil {
+		resBody, err = io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			res = nil
+		} else {
+			res.Body = io.NopCloser(bytes.NewReader(resBody))
+		}
+	}
+	if t.Log != nil {
+		fields := map[string]interface{}{
+			"method":  req.Method,
+			"url":     req.URL.String(),
+			"elapsed": elapsed.String(),
+		}
+		if auth := req.Header.Get("Authorization"); auth != "" {
+			fields["authorization"] = redactHeaders(http.Header{"Authorization": {auth}}).Get("Authorization")
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		} else {
+			fields["status"] = res.StatusCode
+			for _, name := range tracedHeaders {
+				if v := res.Header.Get(name); v != "" {
+					fields[strings.ToLower(name)] = v
+				}
+			}
+		}
+		_ = t.Log("http exchange", fields)
+	}
+	if t.HAR != nil {
+		t.HAR.add(req, reqBody, res, resBody, started, elapsed)
+	}
+	return res, err
+}
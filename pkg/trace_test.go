@@ -0,0 +1,146 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactHeaders(t *testing.T) {
+	t.Parallel()
+	h := http.Header{
+		"Authorization":        {"Bearer aG9nZWJlYXJlcg=="},
+		"Proxy-Authorization":  {"Basic aG9nZTpoaWdl"},
+		"X-Amz-Security-Token": {"hoge"},
+		"Accept":               {"application/json"},
+	}
+	actual := redactHeaders(h)
+	assert.Equal(t, http.Header{
+		"Authorization":        {"Bearer REDACTED"},
+		"Proxy-Authorization":  {"Basic REDACTED"},
+		"X-Amz-Security-Token": {"REDACTED"},
+		"Accept":               {"application/json"},
+	}, actual)
+	assert.Equal(t, "Bearer aG9nZWJlYXJlcg==", h.Get("Authorization"))
+}
+
+func TestRedactBody(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title       string
+		contentType string
+		body        string
+		expect      string
+	}{
+		{
+			title:       "Form",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "grant_type=password&username=hoge&password=hige",
+			expect:      "grant_type=password&password=REDACTED&username=hoge",
+		},
+		{
+			title:       "TokenResponse",
+			contentType: "application/json",
+			body:        `{"token":"aG9nZWJlYXJlcg==","expires_in":300}`,
+			expect:      `{"expires_in":300,"token":"REDACTED"}`,
+		},
+		{
+			title:       "Nested",
+			contentType: "application/x-amz-json-1.1",
+			body:        `{"authorizationData":[{"authorizationToken":"QVdTOmhvZ2U="}]}`,
+			expect:      `{"authorizationData":[{"authorizationToken":"REDACTED"}]}`,
+		},
+		{
+			title:       "Manifest",
+			contentType: "application/vnd.oci.image.index.v1+json",
+			body:        `{"schemaVersion":2}`,
+			expect:      `{"schemaVersion":2}`,
+		},
+		{
+			title:       "Text",
+			contentType: "text/plain",
+			body:        "hoge",
+			expect:      "hoge",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, c.expect, redactBody(c.contentType, []byte(c.body)))
+		})
+	}
+}
+
+func TestTracingTransport(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="https://auth.example.com/token"`)
+		w.Header().Set("RateLimit-Remaining", "99;w=21600")
+		_, _ = w.Write([]byte(`{"token":"aG9nZWJlYXJlcg=="}`))
+	}))
+	defer server.Close()
+	var logged []map[string]interface{}
+	har := NewHAR("container-tag-exists", "test")
+	client := &http.Client{
+		Transport: &TracingTransport{
+			Log: func(_ string, fields map[string]interface{}) error {
+				logged = append(logged, fields)
+				return nil
+			},
+			HAR: har,
+		},
+	}
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/token?service=hoge", bytes.NewReader([]byte("grant_type=refresh_token&refresh_token=hoge")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Basic aG9nZTpoaWdl")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	_, _ = body.ReadFrom(res.Body)
+	res.Body.Close()
+	assert.Equal(t, `{"token":"aG9nZWJlYXJlcg=="}`, body.String())
+
+	assert.Len(t, logged, 1)
+	assert.Equal(t, http.MethodPost, logged[0]["method"])
+	assert.Equal(t, http.StatusOK, logged[0]["status"])
+	assert.Equal(t, "Basic REDACTED", logged[0]["authorization"])
+	assert.Equal(t, "99;w=21600", logged[0]["ratelimit-remaining"])
+	assert.Equal(t, `Bearer realm="https://auth.example.com/token"`, logged[0]["www-authenticate"])
+
+	path := filepath.Join(t.TempDir(), "trace.har")
+	if err := har.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"aG9nZTpoaWdl", "aG9nZWJlYXJlcg==", "refresh_token=hoge"} {
+		assert.False(t, strings.Contains(string(b), secret), "HAR contains %s", secret)
+	}
+	var archive harLog
+	if err := json.Unmarshal(b, &archive); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "1.2", archive.Log.Version)
+	assert.Len(t, archive.Log.Entries, 1)
+	entry := archive.Log.Entries[0]
+	assert.Equal(t, []harNameValue{{Name: "service", Value: "hoge"}}, entry.Request.QueryString)
+	assert.Equal(t, "grant_type=refresh_token&refresh_token=REDACTED", entry.Request.PostData.Text)
+	assert.Equal(t, http.StatusOK, entry.Response.Status)
+	assert.Equal(t, `{"token":"REDACTED"}`, entry.Response.Content.Text)
+}
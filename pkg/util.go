@@ -2,6 +2,7 @@ package pkg
 
 import (
 	"fmt"
+	"net"
 	"regexp"
 	"strings"
 )
@@ -25,10 +26,77 @@ func ExtractImagePath(image string) (string, error) {
 	if len(frag) < 2 {
 		return "", fmt.Errorf("malformed image name %q", image)
 	}
-	return strings.Join(frag[1:], "/"), nil
+	path := strings.Join(frag[1:], "/")
+	// Official images on Docker Hub live under library/.
+	if (frag[0] == "docker.io" || frag[0] == "index.docker.io") && len(frag) == 2 {
+		path = fmt.Sprintf("library/%s", path)
+	}
+	return path, nil
 }
 
-// NormalizeRegistryName converts the registry URL into a normalized name.
+var (
+	hostReplacer = strings.NewReplacer(".", "_", "-", "__")
+)
+
+// NormalizeRegistryName converts the registry URL into a normalized name,
+// suitable for use in environment variable names. The host is capitalized,
+// with "." replaced by "_" and "-" replaced by "__", and IPv6 literals are
+// written as IPV6_ followed by the 32 hexadecimal digits of the address. If
+// the registry URL has a port, it is appended after a "_". Names starting
+// with a digit, such as those of IPv4 addresses or ECR registries, are
+// prefixed with "_", as shells do not accept variable names starting with a
+// digit and no host starts with a character replaced by "_".
 func NormalizeRegistryName(url string) string {
+	host, port := splitHostPort(url)
+	var name string
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		name = fmt.Sprintf("IPV6_%X", []byte(ip.To16()))
+	} else {
+		name = strings.ToUpper(hostReplacer.Replace(host))
+	}
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	if port != "" {
+		name = fmt.Sprintf("%s_%s", name, port)
+	}
+	return name
+}
+
+// LegacyRegistryName converts the registry URL into the normalized name used
+// by previous versions, where ".", ":" and "-" are all replaced by "_".
+func LegacyRegistryName(url string) string {
 	return strings.ToUpper(repoReplacementPattern.ReplaceAllString(url, "_"))
 }
+
+func splitHostPort(url string) (string, string) {
+	if strings.HasPrefix(url, "[") {
+		end := strings.Index(url, "]")
+		if end < 0 {
+			return url, ""
+		}
+		return url[1:end], strings.TrimPrefix(url[end+1:], ":")
+	}
+	if i := strings.LastIndex(url, ":"); i >= 0 {
+		return url[:i], url[i+1:]
+	}
+	return url, ""
+}
+
+// SplitReference splits an image reference of the form IMAGE:TAG,
+// IMAGE@DIGEST or IMAGE:TAG@DIGEST into the image name and the tag or
+// digest. The digest takes precedence over the tag, which is then dropped.
+func SplitReference(ref string) (string, string, error) {
+	if i := strings.LastIndex(ref, "@"); i > 0 {
+		image := ref[:i]
+		if j := strings.LastIndex(image, ":"); j > strings.LastIndex(image, "/") {
+			image = image[:j]
+		}
+		return image, ref[i+1:], nil
+	}
+	i := strings.LastIndex(ref, ":")
+	if i <= strings.LastIndex(ref, "/") {
+		return "", "", fmt.Errorf("missing tag or digest in reference %q", ref)
+	}
+	return ref[:i], ref[i+1:], nil
+}
@@ -78,6 +78,16 @@ func TestExtractImagePath(t *testing.T) {
 			image:  "registry.dev:3000/hsn723/hoge",
 			expect: "hsn723/hoge",
 		},
+		{
+			title:  "DockerHubOfficialImage",
+			image:  "docker.io/alpine",
+			expect: "library/alpine",
+		},
+		{
+			title:  "DockerHubImage",
+			image:  "docker.io/hsn723/hoge",
+			expect: "hsn723/hoge",
+		},
 		{
 			title: "EmptyString",
 			image: "",
@@ -117,6 +127,51 @@ func TestNormalizeRegistryName(t *testing.T) {
 			url:    "registry.dev:3000",
 			expect: "REGISTRY_DEV_3000",
 		},
+		{
+			title:  "Hyphen",
+			url:    "my-hoge.registry.dev",
+			expect: "MY__HOGE_REGISTRY_DEV",
+		},
+		{
+			title:  "HyphenNotPort",
+			url:    "localhost-5000",
+			expect: "LOCALHOST__5000",
+		},
+		{
+			title:  "LocalhostWithPort",
+			url:    "localhost:5000",
+			expect: "LOCALHOST_5000",
+		},
+		{
+			title:  "IPv4WithPort",
+			url:    "10.0.0.1:5000",
+			expect: "_10_0_0_1_5000",
+		},
+		{
+			title:  "IPv4",
+			url:    "192.168.0.1",
+			expect: "_192_168_0_1",
+		},
+		{
+			title:  "ECR",
+			url:    "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+			expect: "_123456789012_DKR_ECR_US__EAST__1_AMAZONAWS_COM",
+		},
+		{
+			title:  "LeadingDigit",
+			url:    "1password.example.com",
+			expect: "_1PASSWORD_EXAMPLE_COM",
+		},
+		{
+			title:  "IPv6WithPort",
+			url:    "[::1]:5000",
+			expect: "IPV6_00000000000000000000000000000001_5000",
+		},
+		{
+			title:  "IPv6",
+			url:    "[fd00::1:5000]",
+			expect: "IPV6_FD000000000000000000000000015000",
+		},
 	}
 	for _, c := range cases {
 		c := c
@@ -127,3 +182,94 @@ func TestNormalizeRegistryName(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitReference(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title     string
+		ref       string
+		image     string
+		reference string
+		isErr     bool
+	}{
+		{
+			title:     "Tag",
+			ref:       "ghcr.io/hsn723/hoge:1.0.0",
+			image:     "ghcr.io/hsn723/hoge",
+			reference: "1.0.0",
+		},
+		{
+			title:     "RegistryWithPort",
+			ref:       "registry.dev:3000/hsn723/hoge:1.0.0",
+			image:     "registry.dev:3000/hsn723/hoge",
+			reference: "1.0.0",
+		},
+		{
+			title:     "Digest",
+			ref:       "ghcr.io/hsn723/hoge@sha256:aaa",
+			image:     "ghcr.io/hsn723/hoge",
+			reference: "sha256:aaa",
+		},
+		{
+			title:     "TagAndDigest",
+			ref:       "ghcr.io/hsn723/hoge:1.0.0@sha256:aaa",
+			image:     "ghcr.io/hsn723/hoge",
+			reference: "sha256:aaa",
+		},
+		{
+			title:     "RegistryWithPortTagAndDigest",
+			ref:       "registry.dev:3000/hsn723/hoge:1.0.0@sha256:aaa",
+			image:     "registry.dev:3000/hsn723/hoge",
+			reference: "sha256:aaa",
+		},
+		{
+			title:     "RegistryWithPortDigest",
+			ref:       "registry.dev:3000/hsn723/hoge@sha256:aaa",
+			image:     "registry.dev:3000/hsn723/hoge",
+			reference: "sha256:aaa",
+		},
+		{
+			title: "MissingTag",
+			ref:   "registry.dev:3000/hsn723/hoge",
+			isErr: true,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			image, reference, err := SplitReference(c.ref)
+			assertExpectedErr(t, err, c.isErr)
+			assert.Equal(t, c.image, image)
+			assert.Equal(t, c.reference, reference)
+		})
+	}
+}
+
+func TestLegacyRegistryName(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title  string
+		url    string
+		expect string
+	}{
+		{
+			title:  "Hyphen",
+			url:    "my-hoge.registry.dev",
+			expect: "MY_HOGE_REGISTRY_DEV",
+		},
+		{
+			title:  "RegistryWithPort",
+			url:    "localhost:5000",
+			expect: "LOCALHOST_5000",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			t.Parallel()
+			actual := LegacyRegistryName(c.url)
+			assert.Equal(t, c.expect, actual)
+		})
+	}
+}